@@ -0,0 +1,40 @@
+// Package apollologr adapts a logr.Logger to apollo.Logger, keeping the
+// go-logr dependency out of the apollo package:
+//
+//	cfg := apollo.DefaultConfig()
+//	cfg.Logger = apollologr.New(logger)
+package apollologr
+
+import (
+	"github.com/go-logr/logr"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+// New adapts l to the apollo.Logger interface. Debug messages are logged at
+// V(1).
+func New(l logr.Logger) apollo.Logger {
+	return logger{l}
+}
+
+type logger struct {
+	logger logr.Logger
+}
+
+var _ apollo.DebugLogger = logger{}
+
+func (ll logger) Info(msg string, keysAndValues ...interface{}) {
+	ll.logger.Info(msg, keysAndValues...)
+}
+
+func (ll logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	ll.logger.Error(err, msg, keysAndValues...)
+}
+
+func (ll logger) Debug(msg string, keysAndValues ...interface{}) {
+	ll.logger.V(1).Info(msg, keysAndValues...)
+}
+
+func (ll logger) DebugEnabled() bool {
+	return ll.logger.V(1).Enabled()
+}
@@ -0,0 +1,43 @@
+package apollologr_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollologr"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestLogger(t *testing.T) {
+	for _, verbosity := range []int{0, 1} {
+		var lines []string
+		l := apollologr.New(funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{Verbosity: verbosity}))
+
+		srv := apollotest.NewServer("token")
+		cfg := srv.Config()
+		cfg.Logger = l
+		cli, err := apollo.NewClient(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = cli.ListTypes(context.Background())
+		l.Error(errors.New("boom"), "failed", "method", "query.ci.types")
+		cli.Close()
+		srv.Close()
+
+		out := strings.Join(lines, "\n")
+		if got := strings.Contains(out, `"msg"="reqBody"`); got != (verbosity > 0) {
+			t.Errorf("verbosity %d: debug payload logged = %v:\n%s", verbosity, got, out)
+		}
+		if !strings.Contains(out, `"msg"="failed" "error"="boom" "method"="query.ci.types"`) {
+			t.Errorf("verbosity %d: no error in logs:\n%s", verbosity, out)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package apollootel instruments apollo.Client with OpenTelemetry tracing.
+// It creates one client span per JSON-RPC call, Iter page and batch, named
+// after the method, and propagates the trace context to Apollo in the request
+// headers:
+//
+//	cfg := apollo.DefaultConfig()
+//	apollootel.Instrument(&cfg, apollootel.WithTracerProvider(tp))
+//	cli, err := apollo.NewClient(cfg)
+package apollootel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+const scope = "github.com/SisyphusSQ/apollo-sdk/apollootel"
+
+// Attribute keys set on the spans.
+const (
+	TypeKey        = attribute.Key("apollo.type")
+	NameKey        = attribute.Key("apollo.name")
+	IDKey          = attribute.Key("apollo.id")
+	GroupKey       = attribute.Key("apollo.group")
+	ResultCountKey = attribute.Key("apollo.result_count")
+	ErrorCodeKey   = attribute.Key("rpc.jsonrpc.error_code")
+)
+
+type config struct {
+	provider    trace.TracerProvider
+	propagators propagation.TextMapPropagator
+}
+
+type Option func(*config)
+
+// WithTracerProvider sets the provider of the tracer, the global one by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithPropagators sets the propagators of the trace context, the global ones
+// by default.
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = p
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		provider:    otel.GetTracerProvider(),
+		propagators: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Instrument adds Middleware, Tracer and Transport to cfg.
+func Instrument(cfg *apollo.Config, opts ...Option) {
+	cfg.Middlewares = append([]apollo.Middleware{Middleware(opts...)}, cfg.Middlewares...)
+	cfg.Tracer = Tracer(opts...)
+	cfg.TransportMiddlewares = append(cfg.TransportMiddlewares, Transport(opts...))
+}
+
+// Middleware starts a client span around every JSON-RPC call.
+func Middleware(opts ...Option) apollo.Middleware {
+	c := newConfig(opts)
+	tracer := c.provider.Tracer(scope)
+
+	return func(next apollo.Invoker) apollo.Invoker {
+		return func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+			ctx, span := start(ctx, tracer, method, params)
+			defer span.End()
+
+			r, err := next(ctx, method, params)
+			if err != nil {
+				setError(span, err)
+				return r, err
+			}
+
+			span.SetAttributes(ResultCountKey.Int(resultCount(r)))
+			return r, nil
+		}
+	}
+}
+
+// Tracer starts a client span around every Iter page and batch, which don't go
+// through Middleware.
+func Tracer(opts ...Option) apollo.Tracer {
+	c := newConfig(opts)
+	return &streamTracer{tracer: c.provider.Tracer(scope)}
+}
+
+type streamTracer struct {
+	tracer trace.Tracer
+}
+
+func (t *streamTracer) Start(ctx context.Context, method string, params map[string]any) (context.Context, func(apollo.CallStats, error)) {
+	ctx, span := start(ctx, t.tracer, method, params)
+	return ctx, func(_ apollo.CallStats, err error) {
+		if err != nil {
+			setError(span, err)
+		}
+		span.End()
+	}
+}
+
+func start(ctx context.Context, tracer trace.Tracer, method string, params map[string]any) (context.Context, trace.Span) {
+	return tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+		),
+		trace.WithAttributes(paramAttrs(params)...),
+	)
+}
+
+func setError(span trace.Span, err error) {
+	var rpcErr *apollo.RPCError
+	if errors.As(err, &rpcErr) {
+		span.SetAttributes(ErrorCodeKey.Int(rpcErr.Code))
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Transport injects the trace context of the request into its headers.
+func Transport(opts ...Option) apollo.TransportMiddleware {
+	c := newConfig(opts)
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			c.propagators.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func paramAttrs(params map[string]any) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, k := range []string{"type", "primary_type"} {
+		if v, ok := params[k]; ok {
+			attrs = append(attrs, TypeKey.String(fmt.Sprint(v)))
+			break
+		}
+	}
+	if v, ok := params["name"]; ok {
+		attrs = append(attrs, NameKey.String(fmt.Sprint(v)))
+	}
+	for _, k := range []string{"id", "referenced_id"} {
+		if v, ok := params[k].(int64); ok {
+			attrs = append(attrs, IDKey.Int64(v))
+			break
+		}
+	}
+	for _, k := range []string{"group_name", "target_group_name"} {
+		if v, ok := params[k]; ok {
+			attrs = append(attrs, GroupKey.String(fmt.Sprint(v)))
+			break
+		}
+	}
+	return attrs
+}
+
+// resultCount counts the elements of an array result without decoding it. An
+// object counts as one result and null as none.
+func resultCount(r json.RawMessage) int {
+	r = bytes.TrimSpace(r)
+	switch {
+	case len(r) == 0 || string(r) == "null":
+		return 0
+	case r[0] != '[':
+		return 1
+	}
+
+	var (
+		depth, commas int
+		empty         = true
+		inStr, escape bool
+	)
+	for _, b := range r {
+		if inStr {
+			switch {
+			case escape:
+				escape = false
+			case b == '\\':
+				escape = true
+			case b == '"':
+				inStr = false
+			}
+			continue
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '"':
+			inStr = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 1 {
+				commas++
+			}
+		}
+		if depth > 1 || (depth == 1 && b != '[') {
+			empty = false
+		}
+	}
+
+	if empty {
+		return 0
+	}
+	return commas + 1
+}
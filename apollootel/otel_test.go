@@ -0,0 +1,150 @@
+package apollootel_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollootel"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestInstrument(t *testing.T) {
+	srv := apollotest.NewServer("token")
+	defer srv.Close()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	var traceparent string
+	cfg := srv.Config()
+	apollootel.Instrument(&cfg, apollootel.WithTracerProvider(tp), apollootel.WithPropagators(propagation.TraceContext{}))
+	cfg.TransportMiddlewares = append(cfg.TransportMiddlewares, func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("traceparent")
+			return next.RoundTrip(req)
+		})
+	})
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	ctx := context.Background()
+
+	if _, err = cli.QueryResByType(ctx, "host"); err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNext("query.resource", apollo.CodeInvalidParams, "bad id")
+	if _, err = cli.QueryResById(ctx, host.ID); err == nil {
+		t.Fatal("QueryResById succeeded")
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	ok := spans[0]
+	if ok.Name() != "query.resource" || ok.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span = %s (%v), want a client span query.resource", ok.Name(), ok.SpanKind())
+	}
+	attrs := attribute.NewSet(ok.Attributes()...)
+	if v, _ := attrs.Value(apollootel.TypeKey); v.AsString() != "host" {
+		t.Errorf("%s = %q, want host", apollootel.TypeKey, v.AsString())
+	}
+	if v, _ := attrs.Value(apollootel.ResultCountKey); v.AsInt64() != 1 {
+		t.Errorf("%s = %d, want 1", apollootel.ResultCountKey, v.AsInt64())
+	}
+
+	failed := spans[1]
+	if failed.Status().Code != codes.Error {
+		t.Errorf("status = %v, want Error", failed.Status())
+	}
+	attrs = attribute.NewSet(failed.Attributes()...)
+	if v, _ := attrs.Value(apollootel.ErrorCodeKey); v.AsInt64() != apollo.CodeInvalidParams {
+		t.Errorf("%s = %d, want %d", apollootel.ErrorCodeKey, v.AsInt64(), apollo.CodeInvalidParams)
+	}
+	if v, _ := attrs.Value(apollootel.IDKey); v.AsInt64() != host.ID {
+		t.Errorf("%s = %d, want %d", apollootel.IDKey, v.AsInt64(), host.ID)
+	}
+
+	if want := failed.SpanContext().TraceID().String(); traceparent == "" || traceparent[3:35] != want {
+		t.Errorf("traceparent = %q, want trace %s", traceparent, want)
+	}
+}
+
+func TestInstrumentIterAndBatch(t *testing.T) {
+	srv := apollotest.NewServer("token")
+	defer srv.Close()
+	for _, name := range []string{"db01", "db02", "db03"} {
+		srv.AddResource(apollotest.Res("host", name, nil), "dba")
+	}
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	var traceparents []string
+	cfg := srv.Config()
+	apollootel.Instrument(&cfg, apollootel.WithTracerProvider(tp), apollootel.WithPropagators(propagation.TraceContext{}))
+	cfg.TransportMiddlewares = append(cfg.TransportMiddlewares, func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			traceparents = append(traceparents, req.Header.Get("traceparent"))
+			return next.RoundTrip(req)
+		})
+	})
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	ctx := context.Background()
+
+	for _, err := range cli.Iter(ctx, apollo.NewQuery().Type("host").Limit(2)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := cli.NewBatch()
+	b.QueryResByTypeAndName("host", "db01")
+	b.QueryResById(999)
+	if err = b.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNext("query.resource", apollo.CodeInternalError, "boom")
+	for range cli.IterResByType(ctx, "host") {
+	}
+
+	spans := sr.Ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	if want := []string{"query.resource", "query.resource", "rpc.batch", "query.resource"}; !slices.Equal(names, want) {
+		t.Fatalf("spans = %v, want %v", names, want)
+	}
+	for i, s := range spans {
+		if want := s.SpanContext().TraceID().String(); len(traceparents) <= i || traceparents[i][3:35] != want {
+			t.Errorf("request %d traceparent = %v, want the trace of span %s", i, traceparents, s.Name())
+		}
+	}
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	if v, _ := attrs.Value(apollootel.TypeKey); v.AsString() != "host" {
+		t.Errorf("%s = %q, want host", apollootel.TypeKey, v.AsString())
+	}
+	failed := spans[3]
+	attrs = attribute.NewSet(failed.Attributes()...)
+	if v, _ := attrs.Value(apollootel.ErrorCodeKey); failed.Status().Code != codes.Error || v.AsInt64() != apollo.CodeInternalError {
+		t.Errorf("failed page status = %v, %s = %d", failed.Status(), apollootel.ErrorCodeKey, v.AsInt64())
+	}
+}
@@ -0,0 +1,126 @@
+// Package apolloprom implements apollo.Metrics with Prometheus collectors:
+//
+//	m := apolloprom.New(apolloprom.Opts{Namespace: "myapp"})
+//	prometheus.MustRegister(m)
+//
+//	cfg := apollo.DefaultConfig()
+//	cfg.Metrics = m
+package apolloprom
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+type Opts struct {
+	Namespace string
+	// Subsystem defaults to "apollo_client".
+	Subsystem   string
+	ConstLabels prometheus.Labels
+	// Buckets of the latency histogram, prometheus.DefBuckets by default.
+	Buckets []float64
+	// SizeBuckets of the payload size histograms, in bytes.
+	SizeBuckets []float64
+}
+
+// Metrics is a prometheus.Collector reporting apollo client calls labelled by
+// method, outcome and HTTP status.
+type Metrics struct {
+	requests     *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+}
+
+var _ apollo.Metrics = (*Metrics)(nil)
+
+func New(opts Opts) *Metrics {
+	if opts.Subsystem == "" {
+		opts.Subsystem = "apollo_client"
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+	if opts.SizeBuckets == nil {
+		opts.SizeBuckets = prometheus.ExponentialBuckets(256, 4, 10)
+	}
+
+	labels := []string{"method", "outcome", "status"}
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "requests_total",
+			Help:        "Number of JSON-RPC calls to Apollo.",
+			ConstLabels: opts.ConstLabels,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "errors_total",
+			Help:        "Number of failed JSON-RPC calls to Apollo.",
+			ConstLabels: opts.ConstLabels,
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "request_duration_seconds",
+			Help:        "Latency of JSON-RPC calls to Apollo, retries included.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, labels),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "request_size_bytes",
+			Help:        "Size of the JSON-RPC requests sent to Apollo.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.SizeBuckets,
+		}, []string{"method"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "response_size_bytes",
+			Help:        "Size of the JSON-RPC responses received from Apollo.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.SizeBuckets,
+		}, []string{"method"}),
+	}
+}
+
+func (m *Metrics) ObserveCall(s apollo.CallStats) {
+	status := ""
+	if s.Status != 0 {
+		status = strconv.Itoa(s.Status)
+	}
+
+	m.requests.WithLabelValues(s.Method, s.Outcome, status).Inc()
+	if s.Outcome != apollo.OutcomeOK {
+		m.errors.WithLabelValues(s.Method, s.Outcome, status).Inc()
+	}
+	m.latency.WithLabelValues(s.Method, s.Outcome, status).Observe(s.Duration.Seconds())
+	m.requestSize.WithLabelValues(s.Method).Observe(float64(s.RequestBytes))
+	if s.ResponseBytes > 0 {
+		m.responseSize.WithLabelValues(s.Method).Observe(float64(s.ResponseBytes))
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.errors.Describe(ch)
+	m.latency.Describe(ch)
+	m.requestSize.Describe(ch)
+	m.responseSize.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.errors.Collect(ch)
+	m.latency.Collect(ch)
+	m.requestSize.Collect(ch)
+	m.responseSize.Collect(ch)
+}
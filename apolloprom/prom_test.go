@@ -0,0 +1,59 @@
+package apolloprom_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apolloprom"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestMetrics(t *testing.T) {
+	srv := apollotest.NewServer("token")
+	defer srv.Close()
+	srv.AddType("host")
+
+	m := apolloprom.New(apolloprom.Opts{Namespace: "test"})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+
+	cfg := srv.Config()
+	cfg.Metrics = m
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err = cli.ListTypes(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.FailNext("query.ci.types", apollo.CodeInternalError, "boom")
+	_, _ = cli.ListTypes(ctx)
+
+	want := `
+# HELP test_apollo_client_errors_total Number of failed JSON-RPC calls to Apollo.
+# TYPE test_apollo_client_errors_total counter
+test_apollo_client_errors_total{method="query.ci.types",outcome="rpc_error",status="200"} 1
+# HELP test_apollo_client_requests_total Number of JSON-RPC calls to Apollo.
+# TYPE test_apollo_client_requests_total counter
+test_apollo_client_requests_total{method="query.ci.types",outcome="ok",status="200"} 2
+test_apollo_client_requests_total{method="query.ci.types",outcome="rpc_error",status="200"} 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"test_apollo_client_requests_total", "test_apollo_client_errors_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m, "test_apollo_client_request_duration_seconds"); n != 2 {
+		t.Errorf("latency series = %d, want 2", n)
+	}
+}
@@ -0,0 +1,520 @@
+package apollotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+// UpdateGoldens makes Golden record the traffic instead of replaying it. It
+// is set when the APOLLOTEST_UPDATE environment variable isn't empty.
+var UpdateGoldens = os.Getenv("APOLLOTEST_UPDATE") != ""
+
+// Exchange is a recorded JSON-RPC call. Responses that aren't JSON-RPC, such
+// as HTTP errors, are kept as Status and Body.
+type Exchange struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+
+	Status int              `json:"status"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *apollo.RPCError `json:"error,omitempty"`
+	Body   string           `json:"body,omitempty"`
+}
+
+// batchMethod is the method of the exchanges recording a whole batch, when the
+// server didn't answer it call by call.
+const batchMethod = "rpc.batch"
+
+// Golden returns the transport of a client under test: a Recorder sending the
+// requests through next and writing them to path when UpdateGoldens is set,
+// a Replayer of path otherwise.
+//
+//	cfg.Transport = apollotest.Golden(t, "testdata/hosts.json", http.DefaultTransport)
+//
+// Run the tests once with APOLLOTEST_UPDATE=1 against a real server to write
+// the golden files.
+func Golden(t testing.TB, path string, next http.RoundTripper) http.RoundTripper {
+	t.Helper()
+
+	if UpdateGoldens {
+		return Record(t, path, next)
+	}
+	return Replay(t, path)
+}
+
+// Recorder is a transport recording the JSON-RPC calls sent through it.
+// Request headers aren't recorded, and the tokens found in the token header
+// are scrubbed from the recorded calls.
+type Recorder struct {
+	next http.RoundTripper
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	tokens    map[string]struct{}
+}
+
+func NewRecorder(next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next, tokens: make(map[string]struct{})}
+}
+
+// Record returns a Recorder that writes its calls to path when t ends.
+func Record(t testing.TB, path string, next http.RoundTripper) *Recorder {
+	t.Helper()
+
+	r := NewRecorder(next)
+	t.Cleanup(func() {
+		if err := r.Save(path); err != nil {
+			t.Errorf("apollotest: %v", err)
+		}
+	})
+	return r
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, req, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	exchanges, err := record(reqBody, resp.StatusCode, respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token := req.Header.Get("token"); token != "" {
+		r.tokens[token] = struct{}{}
+	}
+	r.exchanges = append(r.exchanges, exchanges...)
+	return resp, nil
+}
+
+// Exchanges returns the calls recorded so far.
+func (r *Recorder) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Save writes the recorded calls to path, creating its directory. The tokens
+// are replaced by [REDACTED] in every string of the calls.
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exchanges := make([]Exchange, 0, len(r.exchanges))
+	for _, ex := range r.exchanges {
+		exchanges = append(exchanges, r.scrub(ex))
+	}
+	data, err := json.MarshalIndent(exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// scrub returns a copy of ex without the recorded tokens.
+func (r *Recorder) scrub(ex Exchange) Exchange {
+	ex.Params = r.scrubRaw(ex.Params)
+	ex.Result = r.scrubRaw(ex.Result)
+	ex.Body = r.scrubString(ex.Body)
+	if ex.Error != nil {
+		e := *ex.Error
+		e.Message = r.scrubString(e.Message)
+		e.Data, _ = r.scrubValue(e.Data)
+		ex.Error = &e
+	}
+	return ex
+}
+
+// scrubRaw scrubs the strings of a JSON document, which is only re-encoded
+// if one of them changed.
+func (r *Recorder) scrubRaw(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		// not JSON, e.g. a truncated body.
+		return json.RawMessage(r.scrubString(string(raw)))
+	}
+	v, changed := r.scrubValue(v)
+	if !changed {
+		return raw
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func (r *Recorder) scrubValue(v any) (any, bool) {
+	changed := false
+	switch x := v.(type) {
+	case string:
+		s := r.scrubString(x)
+		return s, s != x
+	case map[string]any:
+		for k, e := range x {
+			var c bool
+			if x[k], c = r.scrubValue(e); c {
+				changed = true
+			}
+		}
+	case []any:
+		for i, e := range x {
+			var c bool
+			if x[i], c = r.scrubValue(e); c {
+				changed = true
+			}
+		}
+	}
+	return v, changed
+}
+
+func (r *Recorder) scrubString(s string) string {
+	for token := range r.tokens {
+		s = strings.ReplaceAll(s, token, "[REDACTED]")
+	}
+	return s
+}
+
+// record splits a request and its response into exchanges.
+func record(reqBody []byte, status int, respBody []byte) ([]Exchange, error) {
+	calls, batch, err := parseCalls(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var rpc []rpcResult
+	if status/100 == 2 {
+		if batch {
+			_ = json.Unmarshal(respBody, &rpc)
+		} else {
+			var res rpcResult
+			if json.Unmarshal(respBody, &res) == nil {
+				rpc = []rpcResult{res}
+			}
+		}
+	}
+	if rpc == nil {
+		// not a JSON-RPC response, or a rejected batch.
+		var single rpcResult
+		ex := Exchange{Method: calls[0].Method, Params: calls[0].Params, Status: status}
+		if batch {
+			ex.Method, ex.Params = batchMethod, batchParams(calls)
+		}
+		if status/100 == 2 && json.Unmarshal(respBody, &single) == nil && single.Error != nil {
+			ex.Error = single.Error
+		} else {
+			ex.Body = string(respBody)
+		}
+		return []Exchange{ex}, nil
+	}
+
+	byID := make(map[string]rpcResult, len(rpc))
+	for _, res := range rpc {
+		byID[string(res.Id)] = res
+	}
+
+	exchanges := make([]Exchange, 0, len(calls))
+	for _, call := range calls {
+		res, ok := byID[string(call.Id)]
+		if !ok && !batch {
+			res, ok = rpc[0], true
+		}
+		if !ok {
+			continue
+		}
+		exchanges = append(exchanges, Exchange{
+			Method: call.Method,
+			Params: call.Params,
+			Status: status,
+			Result: res.Result,
+			Error:  res.Error,
+		})
+	}
+	return exchanges, nil
+}
+
+// Replayer is a transport answering the JSON-RPC calls recorded in a golden
+// file. Calls are matched on their method and params, the order of the keys
+// and the ids aside. Identical calls get the recorded responses in order, the
+// last one being repeated. A call that wasn't recorded fails the test.
+type Replayer struct {
+	t testing.TB
+
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+}
+
+// Replay returns a Replayer of the golden file path. It fails the test if the
+// file can't be read.
+func Replay(t testing.TB, path string) *Replayer {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("apollotest: %v (run with APOLLOTEST_UPDATE=1 to record it)", err)
+	}
+	var exchanges []Exchange
+	if err = json.Unmarshal(data, &exchanges); err != nil {
+		t.Fatalf("apollotest: invalid golden file %s: %v", path, err)
+	}
+	return NewReplayer(t, exchanges)
+}
+
+func NewReplayer(t testing.TB, exchanges []Exchange) *Replayer {
+	r := &Replayer{t: t, exchanges: make(map[string][]Exchange)}
+	for _, ex := range exchanges {
+		k := key(ex.Method, ex.Params)
+		r.exchanges[k] = append(r.exchanges[k], ex)
+	}
+	return r
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, _, err := readRequest(req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	calls, batch, err := parseCalls(reqBody)
+	if err != nil {
+		return nil, r.fail("%v", err)
+	}
+
+	if batch {
+		if ex, ok := r.next(batchMethod, batchParams(calls)); ok {
+			return response(req, ex, nil), nil
+		}
+	}
+
+	results := make([]rpcResult, 0, len(calls))
+	for _, call := range calls {
+		ex, ok := r.next(call.Method, call.Params)
+		if !ok {
+			return nil, r.fail("no recorded response for %s %s", call.Method, canonical(call.Params))
+		}
+		if ex.Result == nil && ex.Error == nil {
+			return response(req, ex, call.Id), nil
+		}
+		results = append(results, rpcResult{Jsonrpc: "2.0", Id: call.Id, Result: ex.Result, Error: ex.Error})
+	}
+
+	var body []byte
+	if batch {
+		body, err = json.Marshal(results)
+	} else {
+		body, err = json.Marshal(results[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(req, http.StatusOK, body), nil
+}
+
+func (r *Replayer) next(method string, params json.RawMessage) (Exchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := key(method, params)
+	queue := r.exchanges[k]
+	if len(queue) == 0 {
+		return Exchange{}, false
+	}
+	if len(queue) > 1 {
+		r.exchanges[k] = queue[1:]
+	}
+	return queue[0], true
+}
+
+func (r *Replayer) fail(format string, args ...any) error {
+	err := fmt.Errorf("apollotest: "+format, args...)
+	r.t.Errorf("%v", err)
+	return err
+}
+
+// response replays an exchange that isn't a JSON-RPC result.
+func response(req *http.Request, ex Exchange, id json.RawMessage) *http.Response {
+	status := ex.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if ex.Error != nil {
+		body, _ := json.Marshal(rpcResult{Jsonrpc: "2.0", Id: id, Error: ex.Error})
+		return newResponse(req, status, body)
+	}
+	return newResponse(req, status, []byte(ex.Body))
+}
+
+func newResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type rpcCall struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcResult struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Id      json.RawMessage  `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *apollo.RPCError `json:"error,omitempty"`
+}
+
+// parseCalls decodes a JSON-RPC request or batch, with canonical params.
+func parseCalls(body []byte) ([]rpcCall, bool, error) {
+	var (
+		calls []rpcCall
+		batch = strings.HasPrefix(string(bytes.TrimSpace(body)), "[")
+	)
+	if batch {
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return nil, true, fmt.Errorf("invalid batch request: %w", err)
+		}
+	} else {
+		var call rpcCall
+		if err := json.Unmarshal(body, &call); err != nil {
+			return nil, false, fmt.Errorf("invalid request: %w", err)
+		}
+		calls = []rpcCall{call}
+	}
+	if len(calls) == 0 {
+		return nil, batch, fmt.Errorf("empty batch request")
+	}
+
+	for i := range calls {
+		calls[i].Params = canonical(calls[i].Params)
+	}
+	return calls, batch, nil
+}
+
+func batchParams(calls []rpcCall) json.RawMessage {
+	type call struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	cs := make([]call, 0, len(calls))
+	for _, c := range calls {
+		cs = append(cs, call{Method: c.Method, Params: c.Params})
+	}
+	raw, _ := json.Marshal(cs)
+	return raw
+}
+
+func key(method string, params json.RawMessage) string {
+	return method + " " + string(canonical(params))
+}
+
+// canonical re-encodes v compactly with sorted object keys.
+func canonical(v json.RawMessage) json.RawMessage {
+	if len(v) == 0 {
+		return json.RawMessage("null")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.UseNumber()
+	var x any
+	if err := dec.Decode(&x); err != nil {
+		return v
+	}
+	raw, err := json.Marshal(x)
+	if err != nil {
+		return v
+	}
+	return raw
+}
+
+// readRequest returns the body of req, and the request to send on. req is
+// left untouched when its body can be read again through GetBody, otherwise
+// the body is consumed and a clone of req is returned with a copy of it.
+func readRequest(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, req, err
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		return data, req, err
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, req, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(data))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, out, nil
+}
+
+// readBody reads *body and replaces it with a copy.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
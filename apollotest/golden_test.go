@@ -0,0 +1,204 @@
+package apollotest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+// goldenCalls runs the calls recorded and replayed by TestGolden.
+func goldenCalls(t *testing.T, cli *apollo.Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	types, err := cli.ListTypes(ctx)
+	if err != nil || !slices.Equal(types, []string{"host"}) {
+		t.Errorf("ListTypes = %v, %v", types, err)
+	}
+	res, err := cli.QueryResByTypeAndName(ctx, "host", "db01")
+	if err != nil || res.Attrs["password"] != "token" {
+		t.Errorf("QueryResByTypeAndName = %+v, %v", res, err)
+	}
+	if _, err = cli.QueryResById(ctx, 999); err != nil {
+		t.Errorf("QueryResById: %v", err)
+	}
+	if _, err = cli.ListUsers(ctx, "nobody"); !errors.Is(err, apollo.ErrInvalidParams) {
+		t.Errorf("ListUsers err = %v, want ErrInvalidParams", err)
+	}
+	if _, err = cli.QueryOpsGroupOwner(ctx, "dba"); !errors.Is(err, apollo.BadGateway) {
+		t.Errorf("QueryOpsGroupOwner err = %v, want BadGateway", err)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "golden.json")
+
+	t.Run("record", func(t *testing.T) {
+		_, srv := newClient(t)
+		srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"password": "token"}), "dba")
+		srv.Inject(apollotest.Fault{Method: "query.ops.group.owner", Status: http.StatusBadGateway})
+
+		rec := apollotest.Record(t, path, http.DefaultTransport)
+		cfg := srv.Config()
+		cfg.Transport = rec
+		cli, err := apollo.NewClient(cfg)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		defer cli.Close()
+
+		goldenCalls(t, cli)
+		if n := len(rec.Exchanges()); n != 5 {
+			t.Errorf("%d exchanges recorded, want 5", n)
+		}
+	})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden file not written: %v", err)
+	}
+	if strings.Contains(string(data), `"token"`) {
+		t.Errorf("token not scrubbed from the golden file:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"password": "[REDACTED]"`) {
+		t.Errorf("token in a result not redacted:\n%s", data)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		cfg := apollo.DefaultConfig()
+		cfg.Url = "http://apollo.invalid"
+		cfg.Token = "token"
+		cfg.Logger = apollo.DiscardLogger
+		cfg.Retry.MaxAttempts = 1
+		cfg.Transport = apollotest.Replay(t, path)
+		cli, err := apollo.NewClient(cfg)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		defer cli.Close()
+
+		ctx := context.Background()
+		if types, err := cli.ListTypes(ctx); err != nil || !slices.Equal(types, []string{"host"}) {
+			t.Errorf("ListTypes = %v, %v", types, err)
+		}
+		if _, err := cli.ListUsers(ctx, "nobody"); !errors.Is(err, apollo.ErrInvalidParams) {
+			t.Errorf("ListUsers err = %v, want ErrInvalidParams", err)
+		}
+		if _, err := cli.QueryOpsGroupOwner(ctx, "dba"); !errors.Is(err, apollo.BadGateway) {
+			t.Errorf("QueryOpsGroupOwner err = %v, want BadGateway", err)
+		}
+	})
+}
+
+func TestRecorderKeepsRequest(t *testing.T) {
+	srv := apollotest.NewServer("token")
+	t.Cleanup(srv.Close)
+	srv.AddType("host")
+
+	body := io.NopCloser(strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"query.ci.types","params":{}}`))
+	req, err := http.NewRequest(http.MethodPost, srv.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("token", "token")
+
+	resp, err := apollotest.NewRecorder(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if req.Body != body {
+		t.Error("RoundTrip replaced the body of the request")
+	}
+	if calls := srv.Calls(); len(calls) != 1 || calls[0].Method != "query.ci.types" {
+		t.Errorf("server calls = %+v", calls)
+	}
+}
+
+// failT records the failures of a Replayer.
+type failT struct {
+	testing.TB
+	failed []string
+}
+
+func (f *failT) Errorf(format string, args ...any) {
+	f.failed = append(f.failed, format)
+}
+
+func TestReplayerMatching(t *testing.T) {
+	ft := &failT{TB: t}
+	rp := apollotest.NewReplayer(ft, []apollotest.Exchange{
+		{Method: "query.resource", Params: []byte(`{"type":"host","name":"db01"}`), Status: 200, Result: []byte(`{"id":1}`)},
+		{Method: "query.resource", Params: []byte(`{"type":"host","name":"db01"}`), Status: 200, Result: []byte(`{"id":2}`)},
+	})
+	roundTrip := func(body string) (string, error) {
+		req, _ := http.NewRequest(http.MethodPost, "http://apollo.invalid", strings.NewReader(body))
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), nil
+	}
+
+	// Params match whatever the order of their keys, and identical calls get
+	// the recorded responses in order, the last one being repeated.
+	for _, want := range []string{`"id":1`, `"id":2`, `"id":2`} {
+		got, err := roundTrip(`{"jsonrpc":"2.0","id":7,"method":"query.resource","params":{"name":"db01","type":"host"}}`)
+		if err != nil || !strings.Contains(got, `"result":{`+want+`}`) || !strings.Contains(got, `"id":7`) {
+			t.Errorf("response = %s, %v, want result %s", got, err, want)
+		}
+	}
+	if len(ft.failed) != 0 {
+		t.Fatalf("replayer failed: %v", ft.failed)
+	}
+
+	if _, err := roundTrip(`{"jsonrpc":"2.0","id":8,"method":"query.resource","params":{"name":"db02"}}`); err == nil {
+		t.Error("unmatched request succeeded")
+	}
+	if len(ft.failed) != 1 {
+		t.Errorf("unmatched request reported %d failures, want 1", len(ft.failed))
+	}
+}
+
+func TestRecorderScrubsTokens(t *testing.T) {
+	srv := apollotest.NewServer("s3cr3t")
+	t.Cleanup(srv.Close)
+	srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"note": "key=s3cr3t;"}), "dba")
+
+	rec := apollotest.NewRecorder(nil)
+	cfg := srv.Config()
+	cfg.Transport = rec
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer cli.Close()
+	if _, err = cli.QueryResByTypeAndName(context.Background(), "host", "db01"); err != nil {
+		t.Fatalf("QueryResByTypeAndName: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "golden.json")
+	if err = rec.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("s3cr3t")) || !bytes.Contains(data, []byte(`key=[REDACTED];`)) {
+		t.Errorf("golden file not scrubbed:\n%s", data)
+	}
+	// The recorded calls are left as they were.
+	if ex := rec.Exchanges(); len(ex) != 1 || !bytes.Contains(ex[0].Result, []byte("s3cr3t")) {
+		t.Errorf("exchanges = %+v", ex)
+	}
+}
@@ -0,0 +1,596 @@
+package apollotest
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+type handler func(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError)
+
+var handlers = map[string]handler{
+	"query.resource":          queryResource,
+	"query.ci.types":          queryTypes,
+	"query.ops.group":         queryOpsGroups,
+	"query.ops.group.members": queryOpsGroupMembers,
+	"query.ops.group.owner":   queryOpsGroupOwner,
+	"query.aggregate":         queryAggregate,
+	"query.ci.ops.group":      queryResOpsGroup,
+	"create.resource":         createResource,
+	"update.resource":         updateResource,
+	"update.ci.ops.group":     deliverResource,
+	"delete.resource":         deleteResource,
+}
+
+type resParams struct {
+	ID            int64             `json:"id"`
+	Type          string            `json:"type"`
+	Name          string            `json:"name"`
+	Group         string            `json:"group_name"`
+	TargetGroup   string            `json:"target_group_name"`
+	Conditions    any               `json:"conditions"`
+	Graph         string            `json:"graph"`
+	Target        string            `json:"target"`
+	PrimaryType   string            `json:"primary_type"`
+	Relationship  string            `json:"relationship"`
+	SecondaryType string            `json:"secondary_type"`
+	ReferencedID  int64             `json:"referenced_id"`
+	Page          int               `json:"page"`
+	Limit         int               `json:"limit"`
+	Username      string            `json:"username"`
+	Resource      *apollo.Resource  `json:"resource"`
+	Resources     []apollo.Resource `json:"resources"`
+	Attributes    apollo.Attr       `json:"attributes"`
+	Rels          apollo.Rel        `json:"rels"`
+	RelsMode      string            `json:"rels_mode"`
+}
+
+func decodeParams(params map[string]json.RawMessage) (resParams, *apollo.RPCError) {
+	var p resParams
+	raw, err := json.Marshal(params)
+	if err == nil {
+		err = json.Unmarshal(raw, &p)
+	}
+	if err != nil {
+		return p, invalidParams("%v", err)
+	}
+	return p, nil
+}
+
+// --------- QUERY ---------
+
+func queryResource(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	switch {
+	case p.ID != 0:
+		if e, ok := s.resources[p.ID]; ok {
+			return s.view(e, true), nil
+		}
+		return nil, nil
+	case p.Type != "" && p.Name != "" && p.Group == "" && p.Conditions == nil:
+		if e := s.lookup(p.Type, p.Name); e != nil {
+			return s.view(e, true), nil
+		}
+		return nil, nil
+	case p.ReferencedID != 0:
+		return s.page(p, s.filter(func(e *entry) bool {
+			for _, refs := range e.res.Rel {
+				if slices.ContainsFunc(refs, func(r apollo.Resource) bool { return r.ID == p.ReferencedID }) {
+					return true
+				}
+			}
+			return false
+		})), nil
+	case p.Graph != "" || p.Target != "":
+		// The fake reads graph as a relationship name and target as the name
+		// of the resource the relationship starts from.
+		var res []*entry
+		for _, e := range s.filter(func(e *entry) bool { return name(e) == p.Target }) {
+			for _, ref := range e.res.Rel[p.Graph] {
+				if r, ok := s.resources[ref.ID]; ok && !slices.Contains(res, r) {
+					res = append(res, r)
+				}
+			}
+		}
+		return s.page(p, res), nil
+	case p.Relationship != "":
+		seen := make(map[int64]bool)
+		for _, e := range s.filter(func(e *entry) bool { return e.res.Type.Name == p.PrimaryType }) {
+			for _, ref := range e.res.Rel[p.Relationship] {
+				if r, ok := s.resources[ref.ID]; ok && r.res.Type.Name == p.SecondaryType {
+					seen[r.res.ID] = true
+				}
+			}
+		}
+		return s.page(p, s.filter(func(e *entry) bool { return seen[e.res.ID] })), nil
+	case p.Type != "" || p.Name != "":
+		return s.page(p, s.filter(func(e *entry) bool {
+			return (p.Type == "" || e.res.Type.Name == p.Type) &&
+				(p.Name == "" || name(e) == p.Name) &&
+				(p.Group == "" || e.group == p.Group) &&
+				(p.Conditions == nil || match(e.res.Attrs, p.Conditions))
+		})), nil
+	}
+	return nil, invalidParams("unsupported query.resource params")
+}
+
+func queryTypes(s *Server, _ map[string]json.RawMessage) (any, *apollo.RPCError) {
+	types := slices.Clone(s.types)
+	slices.Sort(types)
+	return types, nil
+}
+
+func queryOpsGroups(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	names := make([]string, 0, len(s.groups))
+	for _, g := range s.groups {
+		if p.Username == "" || g.Owner.Username == p.Username ||
+			slices.ContainsFunc(g.Users, func(u apollo.OpsUser) bool { return u.Username == p.Username }) {
+			names = append(names, g.Name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func queryOpsGroupMembers(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	g, rpcErr := s.groupParam(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	users := make([]string, 0, len(g.Users))
+	for _, u := range g.Users {
+		users = append(users, u.Username)
+	}
+	return users, nil
+}
+
+func queryOpsGroupOwner(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	g, rpcErr := s.groupParam(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return g.Owner.Username, nil
+}
+
+func queryAggregate(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	result, ok := s.aggregates[p.Graph]
+	if !ok {
+		return nil, notFound("graph %q", p.Graph)
+	}
+	return result, nil
+}
+
+func queryResOpsGroup(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	e, rpcErr := s.resourceParam(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	g, ok := s.groups[e.group]
+	if !ok {
+		return nil, notFound("ops group %q", e.group)
+	}
+	return g, nil
+}
+
+// --------- CRUD ---------
+
+func createResource(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if p.Resource != nil {
+		if rpcErr = s.checkNew(*p.Resource); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return s.add(*p.Resource, p.Group), nil
+	}
+
+	for _, res := range p.Resources {
+		if rpcErr = s.checkNew(res); rpcErr != nil {
+			return nil, rpcErr
+		}
+	}
+	for _, res := range p.Resources {
+		s.add(res, p.Group)
+	}
+	return true, nil
+}
+
+func updateResource(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	switch {
+	case p.Resource != nil:
+		return s.update(*p.Resource), nil
+	case p.Resources != nil:
+		ok := true
+		for _, res := range p.Resources {
+			ok = s.update(res) && ok
+		}
+		return ok, nil
+	case p.Rels != nil:
+		e, ok := s.resources[p.ID]
+		if !ok {
+			return false, nil
+		}
+		return true, relate(e, p.Rels, p.RelsMode)
+	}
+
+	var e *entry
+	if p.ID != 0 {
+		e = s.resources[p.ID]
+	} else {
+		e = s.lookup(p.Type, p.Name)
+	}
+	if e == nil {
+		return false, nil
+	}
+	maps.Copy(e.res.Attrs, normalize(p.Attributes))
+	return true, nil
+}
+
+func deliverResource(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	e, ok := s.resources[p.ID]
+	if !ok {
+		return false, nil
+	}
+	if _, ok = s.groups[p.TargetGroup]; !ok {
+		return nil, notFound("ops group %q", p.TargetGroup)
+	}
+	e.group = p.TargetGroup
+	return true, nil
+}
+
+func deleteResource(s *Server, params map[string]json.RawMessage) (any, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var e *entry
+	if p.ID != 0 {
+		e = s.resources[p.ID]
+	} else {
+		e = s.lookup(p.Type, p.Name)
+	}
+	if e == nil {
+		return false, nil
+	}
+
+	id := e.res.ID
+	delete(s.resources, id)
+	for _, other := range s.resources {
+		for rel, refs := range other.res.Rel {
+			other.res.Rel[rel] = slices.DeleteFunc(refs, func(r apollo.Resource) bool { return r.ID == id })
+		}
+	}
+	return true, nil
+}
+
+// --------- store ---------
+
+func (s *Server) add(res apollo.Resource, group string) apollo.Resource {
+	res = normalizeRes(res)
+	if res.ID == 0 {
+		s.nextID++
+		res.ID = s.nextID
+	} else if res.ID > s.nextID {
+		s.nextID = res.ID
+	}
+
+	if !slices.Contains(s.types, res.Type.Name) {
+		s.types = append(s.types, res.Type.Name)
+	}
+
+	e := &entry{res: res, group: group}
+	s.resources[res.ID] = e
+	return s.view(e, true)
+}
+
+func (s *Server) checkNew(res apollo.Resource) *apollo.RPCError {
+	if res.Type.Name == "" {
+		return invalidParams("resource type is required")
+	}
+	n, _ := res.Attrs["name"].(string)
+	if n != "" && s.lookup(res.Type.Name, n) != nil {
+		return invalidParams("resource %s %q already exists", res.Type.Name, n)
+	}
+	return nil
+}
+
+func (s *Server) update(res apollo.Resource) bool {
+	e, ok := s.resources[res.ID]
+	if !ok {
+		n, _ := res.Attrs["name"].(string)
+		if e = s.lookup(res.Type.Name, n); e == nil {
+			return false
+		}
+	}
+
+	res = normalizeRes(res)
+	maps.Copy(e.res.Attrs, res.Attrs)
+	if len(res.Rel) > 0 {
+		_ = relate(e, res.Rel, "replace")
+	}
+	return true
+}
+
+func relate(e *entry, rels apollo.Rel, mode string) *apollo.RPCError {
+	if e.res.Rel == nil {
+		e.res.Rel = make(apollo.Rel)
+	}
+
+	for rel, refs := range rels {
+		stubs := make([]apollo.Resource, 0, len(refs))
+		for _, r := range refs {
+			stubs = append(stubs, apollo.Resource{ResBase: apollo.ResBase{ID: r.ID}})
+		}
+
+		switch mode {
+		case "", "replace":
+			e.res.Rel[rel] = stubs
+		case "add", "append":
+			for _, st := range stubs {
+				if !slices.ContainsFunc(e.res.Rel[rel], func(r apollo.Resource) bool { return r.ID == st.ID }) {
+					e.res.Rel[rel] = append(e.res.Rel[rel], st)
+				}
+			}
+		case "delete", "remove":
+			e.res.Rel[rel] = slices.DeleteFunc(e.res.Rel[rel], func(r apollo.Resource) bool {
+				return slices.ContainsFunc(stubs, func(st apollo.Resource) bool { return st.ID == r.ID })
+			})
+		default:
+			return invalidParams("unknown rels_mode %q", mode)
+		}
+	}
+	return nil
+}
+
+func (s *Server) lookup(rType, n string) *entry {
+	for _, e := range s.resources {
+		if e.res.Type.Name == rType && name(e) == n {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Server) filter(keep func(e *entry) bool) []*entry {
+	var res []*entry
+	for _, e := range s.resources {
+		if keep(e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// page sorts entries by id, applies page/limit and renders them.
+func (s *Server) page(p resParams, entries []*entry) []apollo.Resource {
+	slices.SortFunc(entries, func(a, b *entry) int { return int(a.res.ID - b.res.ID) })
+	if p.Limit > 0 {
+		start := min(max(p.Page-1, 0)*p.Limit, len(entries))
+		entries = entries[start:min(start+p.Limit, len(entries))]
+	}
+
+	res := make([]apollo.Resource, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, s.view(e, true))
+	}
+	return res
+}
+
+// view copies a stored resource. With rels, the related resources are
+// rendered one level deep.
+func (s *Server) view(e *entry, rels bool) apollo.Resource {
+	res := apollo.Resource{ResBase: e.res.ResBase, Attrs: maps.Clone(e.res.Attrs)}
+	if !rels || len(e.res.Rel) == 0 {
+		return res
+	}
+
+	res.Rel = make(apollo.Rel, len(e.res.Rel))
+	for rel, refs := range e.res.Rel {
+		for _, ref := range refs {
+			if r, ok := s.resources[ref.ID]; ok {
+				res.Rel[rel] = append(res.Rel[rel], s.view(r, false))
+			}
+		}
+	}
+	return res
+}
+
+func (s *Server) groupParam(params map[string]json.RawMessage) (*apollo.OpsGroup, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	g, ok := s.groups[p.Group]
+	if !ok {
+		return nil, notFound("ops group %q", p.Group)
+	}
+	return g, nil
+}
+
+func (s *Server) resourceParam(params map[string]json.RawMessage) (*entry, *apollo.RPCError) {
+	p, rpcErr := decodeParams(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var e *entry
+	if p.ID != 0 {
+		e = s.resources[p.ID]
+	} else {
+		e = s.lookup(p.Type, p.Name)
+	}
+	if e == nil {
+		return nil, notFound("resource")
+	}
+	return e, nil
+}
+
+func name(e *entry) string {
+	n, _ := e.res.Attrs["name"].(string)
+	return n
+}
+
+func notFound(format string, args ...any) *apollo.RPCError {
+	return &apollo.RPCError{Code: apollo.CodeInvalidParams, Message: fmt.Sprintf(format, args...) + " not found"}
+}
+
+// normalizeRes round-trips res through JSON so that stored attributes have the
+// same Go types as decoded params.
+func normalizeRes(res apollo.Resource) apollo.Resource {
+	res.Attrs = normalize(res.Attrs)
+	if res.Attrs == nil {
+		res.Attrs = make(apollo.Attr)
+	}
+
+	rels := res.Rel
+	res.Rel = make(apollo.Rel, len(rels))
+	for rel, refs := range rels {
+		for _, r := range refs {
+			res.Rel[rel] = append(res.Rel[rel], apollo.Resource{ResBase: apollo.ResBase{ID: r.ID}})
+		}
+	}
+	return res
+}
+
+func normalize(attrs apollo.Attr) apollo.Attr {
+	if attrs == nil {
+		return nil
+	}
+
+	var out apollo.Attr
+	raw, _ := json.Marshal(attrs)
+	_ = json.Unmarshal(raw, &out)
+	return out
+}
+
+// --------- conditions ---------
+
+// match evaluates the conditions document built by apollo.Cond against attrs.
+func match(attrs apollo.Attr, cond any) bool {
+	switch c := cond.(type) {
+	case []any:
+		for _, sub := range c {
+			if !match(attrs, sub) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		for k, v := range c {
+			var ok bool
+			switch k {
+			case "$and":
+				ok = match(attrs, v)
+			case "$or":
+				subs, _ := v.([]any)
+				ok = slices.ContainsFunc(subs, func(sub any) bool { return match(attrs, sub) })
+			case "$not":
+				ok = !match(attrs, v)
+			default:
+				ok = matchField(attrs[k], v)
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func matchField(value, cond any) bool {
+	ops, isOps := cond.(map[string]any)
+	if isOps {
+		for op := range ops {
+			if !strings.HasPrefix(op, "$") {
+				isOps = false
+			}
+		}
+	}
+	if !isOps {
+		return reflect.DeepEqual(value, cond)
+	}
+
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$in":
+			values, _ := arg.([]any)
+			ok = slices.ContainsFunc(values, func(v any) bool { return reflect.DeepEqual(value, v) })
+		case "$like":
+			pattern, _ := arg.(string)
+			str, isStr := value.(string)
+			ok = isStr && likeRegexp(pattern).MatchString(str)
+		case "$gt", "$gte", "$lt", "$lte":
+			var n int
+			if n, ok = compare(value, arg); ok {
+				ok = map[string]bool{"$gt": n > 0, "$gte": n >= 0, "$lt": n < 0, "$lte": n <= 0}[op]
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders two numbers or two strings, anything else is unordered.
+func compare(a, b any) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmp.Compare(x, y), true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+func likeRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "%")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
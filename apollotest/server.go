@@ -0,0 +1,382 @@
+// Package apollotest provides an in-process fake of the Apollo JSON-RPC server
+// for tests. It keeps CIs, relations and ops groups in memory and implements
+// the methods used by apollo.Client:
+//
+//	srv := apollotest.NewServer("token")
+//	defer srv.Close()
+//
+//	srv.AddGroup(apollo.OpsGroup{Name: "dba", Owner: apollo.OpsUser{Username: "alice"}})
+//	host := srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"cpu": 8}), "dba")
+//
+//	cli, _ := apollo.NewClient(srv.Config())
+package apollotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+// Call is a request received by the Server.
+type Call struct {
+	Method string
+	Params map[string]any
+}
+
+// Fault is an error injected into the responses of a method. Exactly one of
+// RPC and Status should be set.
+type Fault struct {
+	// Method is the JSON-RPC method to fail, "" fails every method.
+	Method string
+	RPC    *apollo.RPCError
+	// Status is an HTTP status code answered with an empty body.
+	Status int
+	// RetryAfter is sent in the Retry-After header along with Status.
+	RetryAfter time.Duration
+	// Times is the number of calls to fail, 0 fails them all until the fault
+	// is cleared.
+	Times int
+}
+
+type Server struct {
+	*httptest.Server
+
+	token string
+
+	mu         sync.Mutex
+	nextID     int64
+	resources  map[int64]*entry
+	groups     map[string]*apollo.OpsGroup
+	types      []string
+	aggregates map[string]any
+	faults     []*Fault
+	calls      []Call
+	noBatch    bool
+}
+
+type entry struct {
+	res   apollo.Resource
+	group string
+}
+
+// NewServer starts a fake Apollo server accepting token.
+func NewServer(token string) *Server {
+	s := &Server{
+		token:      token,
+		resources:  make(map[int64]*entry),
+		groups:     make(map[string]*apollo.OpsGroup),
+		aggregates: make(map[string]any),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a client config pointing at s, with logs discarded and
+// retries disabled.
+func (s *Server) Config() apollo.Config {
+	c := apollo.DefaultConfig()
+	c.Url = s.URL
+	c.Token = s.token
+	c.Logger = apollo.DiscardLogger
+	c.Retry.MaxAttempts = 1
+	return c
+}
+
+// Res builds a resource of type rType named name.
+func Res(rType, name string, attrs apollo.Attr) apollo.Resource {
+	a := apollo.Attr{"name": name}
+	for k, v := range attrs {
+		a[k] = v
+	}
+	return apollo.Resource{
+		ResBase: apollo.ResBase{Type: apollo.RType{Name: rType}},
+		Attrs:   a,
+	}
+}
+
+// AddResource stores res in group and returns it with its assigned id. The
+// relations of res only need the ids of the related resources.
+func (s *Server) AddResource(res apollo.Resource, group string) apollo.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(res, group)
+}
+
+// Resource returns the stored resource id.
+func (s *Server) Resource(id int64) (apollo.Resource, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.resources[id]
+	if !ok {
+		return apollo.Resource{}, false
+	}
+	return s.view(e, true), true
+}
+
+// Group returns the ops group of the resource id.
+func (s *Server) Group(id int64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.resources[id]
+	if !ok {
+		return "", false
+	}
+	return e.group, true
+}
+
+// Relate adds a relation named rel from the resource from to the resource to.
+func (s *Server) Relate(from int64, rel string, to int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.resources[from]
+	if !ok {
+		return
+	}
+	if e.res.Rel == nil {
+		e.res.Rel = make(apollo.Rel)
+	}
+	e.res.Rel[rel] = append(e.res.Rel[rel], apollo.Resource{ResBase: apollo.ResBase{ID: to}})
+}
+
+// AddType registers a CI type even if no resource uses it yet.
+func (s *Server) AddType(rType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(s.types, rType) {
+		s.types = append(s.types, rType)
+	}
+}
+
+// AddGroup stores an ops group, replacing the group of the same name.
+func (s *Server) AddGroup(g apollo.OpsGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g.Id == 0 {
+		s.nextID++
+		g.Id = s.nextID
+	}
+	s.groups[g.Name] = &g
+}
+
+// SetAggregate sets the result of query.aggregate for graph.
+func (s *Server) SetAggregate(graph string, result any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aggregates[graph] = result
+}
+
+// Inject adds a fault. Faults are matched in the order they were added.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// FailNext fails the next call of method with the JSON-RPC error code.
+func (s *Server) FailNext(method string, code int, message string) {
+	s.Inject(Fault{Method: method, RPC: &apollo.RPCError{Code: code, Message: message}, Times: 1})
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// DisableBatch makes s reject batch requests like servers that don't support
+// them.
+func (s *Server) DisableBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.noBatch = true
+}
+
+// Calls returns the requests received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.calls)
+}
+
+type rpcRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      any                        `json:"id"`
+	Method  string                     `json:"method"`
+	Params  map[string]json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Id      any              `json:"id"`
+	Result  any              `json:"result"`
+	Error   *apollo.RPCError `json:"error,omitempty"`
+
+	retryAfter time.Duration
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("token") != s.token {
+		writeJSON(w, http.StatusUnauthorized, rpcResponse{
+			Jsonrpc: "2.0",
+			Error:   &apollo.RPCError{Code: apollo.CodeInvalidRequest, Message: "invalid token"},
+		})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		s.serveBatch(w, body)
+		return
+	}
+
+	var req rpcRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{
+			Jsonrpc: "2.0",
+			Error:   &apollo.RPCError{Code: apollo.CodeParseError, Message: err.Error()},
+		})
+		return
+	}
+
+	status, resp := s.handle(req)
+	if status != http.StatusOK {
+		writeStatus(w, status, resp)
+		return
+	}
+	writeJSON(w, status, resp)
+}
+
+// serveBatch answers a JSON-RPC batch. An HTTP fault on any call of the batch
+// fails the whole request.
+func (s *Server) serveBatch(w http.ResponseWriter, body []byte) {
+	s.mu.Lock()
+	noBatch := s.noBatch
+	s.mu.Unlock()
+	if noBatch {
+		writeJSON(w, http.StatusOK, rpcResponse{
+			Jsonrpc: "2.0",
+			Error:   &apollo.RPCError{Code: apollo.CodeInvalidRequest, Message: "batch not supported"},
+		})
+		return
+	}
+
+	var reqs []rpcRequest
+	if err := json.Unmarshal(body, &reqs); err != nil || len(reqs) == 0 {
+		writeJSON(w, http.StatusOK, rpcResponse{
+			Jsonrpc: "2.0",
+			Error:   &apollo.RPCError{Code: apollo.CodeInvalidRequest, Message: "invalid batch"},
+		})
+		return
+	}
+
+	resps := make([]rpcResponse, 0, len(reqs))
+	for _, req := range reqs {
+		status, resp := s.handle(req)
+		if status != http.StatusOK {
+			writeStatus(w, status, resp)
+			return
+		}
+		resps = append(resps, resp)
+	}
+	writeJSON(w, http.StatusOK, resps)
+}
+
+func (s *Server) handle(req rpcRequest) (int, rpcResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	params := make(map[string]any, len(req.Params))
+	for k, v := range req.Params {
+		var p any
+		_ = json.Unmarshal(v, &p)
+		params[k] = p
+	}
+	s.calls = append(s.calls, Call{Method: req.Method, Params: params})
+
+	resp := rpcResponse{Jsonrpc: "2.0", Id: req.Id}
+	if f := s.fault(req.Method); f != nil {
+		if f.Status != 0 {
+			resp.retryAfter = f.RetryAfter
+			return f.Status, resp
+		}
+		resp.Error = f.RPC
+		return http.StatusOK, resp
+	}
+
+	h, ok := handlers[req.Method]
+	if !ok {
+		resp.Error = &apollo.RPCError{Code: apollo.CodeMethodNotFound, Message: "method not found: " + req.Method}
+		return http.StatusOK, resp
+	}
+
+	result, err := h(s, req.Params)
+	if err != nil {
+		resp.Error = err
+		return http.StatusOK, resp
+	}
+	resp.Result = result
+	return http.StatusOK, resp
+}
+
+func (s *Server) fault(method string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func writeStatus(w http.ResponseWriter, status int, resp rpcResponse) {
+	if resp.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(resp.retryAfter.Seconds())))
+	}
+	w.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func invalidParams(format string, args ...any) *apollo.RPCError {
+	return &apollo.RPCError{Code: apollo.CodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
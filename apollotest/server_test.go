@@ -0,0 +1,215 @@
+package apollotest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func newClient(t *testing.T) (*apollo.Client, *apollotest.Server) {
+	t.Helper()
+
+	srv := apollotest.NewServer("token")
+	t.Cleanup(srv.Close)
+	cli, err := apollo.NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(cli.Close)
+	return cli, srv
+}
+
+func TestServerCRUD(t *testing.T) {
+	cli, srv := newClient(t)
+	ctx := context.Background()
+	srv.AddGroup(apollo.OpsGroup{Name: "dba"})
+	srv.AddGroup(apollo.OpsGroup{Name: "web"})
+
+	created, err := cli.CreateRes(ctx, apollotest.Res("host", "db01", apollo.Attr{"cpu": 8}), "dba")
+	if err != nil {
+		t.Fatalf("CreateRes: %v", err)
+	}
+	if created.ID == 0 {
+		t.Fatal("CreateRes didn't assign an id")
+	}
+	if _, err = cli.CreateRes(ctx, apollotest.Res("host", "db01", nil), "dba"); !errors.Is(err, apollo.ErrInvalidParams) {
+		t.Errorf("CreateRes(duplicate) = %v, want ErrInvalidParams", err)
+	}
+
+	got, err := cli.QueryResByTypeAndName(ctx, "host", "db01")
+	if err != nil || got.ID != created.ID || got.Attrs["cpu"] != float64(8) {
+		t.Fatalf("QueryResByTypeAndName = %+v, %v", got, err)
+	}
+
+	if ok, err := cli.UpdateResById(ctx, created.ID, apollo.Attr{"cpu": 16}); err != nil || !ok {
+		t.Fatalf("UpdateResById = %v, %v", ok, err)
+	}
+	if r, _ := srv.Resource(created.ID); r.Attrs["cpu"] != float64(16) || r.Attrs["name"] != "db01" {
+		t.Errorf("stored attributes = %v, want cpu 16 and the name kept", r.Attrs)
+	}
+	if ok, err := cli.UpdateResById(ctx, created.ID+100, apollo.Attr{"cpu": 1}); err != nil || ok {
+		t.Errorf("UpdateResById(missing) = %v, %v, want false", ok, err)
+	}
+
+	if ok, err := cli.DeliverRes(ctx, "web", created.ID); err != nil || !ok {
+		t.Fatalf("DeliverRes = %v, %v", ok, err)
+	}
+	if g, _ := srv.Group(created.ID); g != "web" {
+		t.Errorf("group = %q, want web", g)
+	}
+	og, err := cli.QueryResOpsGroupById(ctx, created.ID)
+	if err != nil || og.Name != "web" {
+		t.Errorf("QueryResOpsGroupById = %+v, %v", og, err)
+	}
+
+	if ok, err := cli.DeleteById(ctx, created.ID); err != nil || !ok {
+		t.Fatalf("DeleteById = %v, %v", ok, err)
+	}
+	if _, ok := srv.Resource(created.ID); ok {
+		t.Error("resource still stored after DeleteById")
+	}
+	if ok, err := cli.DeleteById(ctx, created.ID); err != nil || ok {
+		t.Errorf("DeleteById(deleted) = %v, %v, want false", ok, err)
+	}
+}
+
+func TestServerRelations(t *testing.T) {
+	cli, srv := newClient(t)
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	app := srv.AddResource(apollotest.Res("app", "api", nil), "dba")
+	srv.Relate(app.ID, "runs_on", host.ID)
+
+	refs, err := cli.QueryResByReferId(ctx, host.ID)
+	if err != nil || len(refs) != 1 || refs[0].ID != app.ID {
+		t.Fatalf("QueryResByReferId = %v, %v, want [api]", refs, err)
+	}
+	rel, err := cli.QueryResByTypeAndRelationship(ctx, "app", "runs_on", "host")
+	if err != nil || len(rel) != 1 || rel[0].ID != host.ID {
+		t.Errorf("QueryResByTypeAndRelationship = %v, %v, want [db01]", rel, err)
+	}
+
+	if _, err = cli.DeleteById(ctx, host.ID); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := srv.Resource(app.ID); len(r.Rel["runs_on"]) != 0 {
+		t.Errorf("relations = %v, want the deleted host dropped", r.Rel)
+	}
+}
+
+func TestServerGroups(t *testing.T) {
+	cli, srv := newClient(t)
+	ctx := context.Background()
+	srv.AddGroup(apollo.OpsGroup{Name: "dba", Owner: apollo.OpsUser{Username: "alice"}, Users: []apollo.OpsUser{{Username: "bob"}}})
+	srv.AddGroup(apollo.OpsGroup{Name: "web", Owner: apollo.OpsUser{Username: "carol"}})
+
+	groups, err := cli.ListOpsGroups(ctx)
+	if err != nil || !slices.Equal(groups, []string{"dba", "web"}) {
+		t.Errorf("ListOpsGroups = %v, %v", groups, err)
+	}
+	groups, err = cli.ListOpsGroupsWithUser(ctx, "bob")
+	if err != nil || !slices.Equal(groups, []string{"dba"}) {
+		t.Errorf("ListOpsGroupsWithUser(bob) = %v, %v", groups, err)
+	}
+	owner, err := cli.QueryOpsGroupOwner(ctx, "web")
+	if err != nil || owner != "carol" {
+		t.Errorf("QueryOpsGroupOwner = %q, %v", owner, err)
+	}
+	if _, err = cli.QueryOpsGroupOwner(ctx, "missing"); !errors.Is(err, apollo.ErrInvalidParams) {
+		t.Errorf("QueryOpsGroupOwner(missing) = %v, want ErrInvalidParams", err)
+	}
+
+	srv.AddType("switch")
+	srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	types, err := cli.ListTypes(ctx)
+	if err != nil || !slices.Equal(types, []string{"host", "switch"}) {
+		t.Errorf("ListTypes = %v, %v", types, err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	cli, srv := newClient(t)
+	ctx := context.Background()
+
+	srv.FailNext("query.resource", apollo.CodeInternalError, "boom")
+	if _, err := cli.QueryResById(ctx, 1); !errors.Is(err, apollo.ErrInternal) {
+		t.Errorf("first call = %v, want ErrInternal", err)
+	}
+	if _, err := cli.QueryResById(ctx, 1); err != nil {
+		t.Errorf("second call = %v, want the fault used up", err)
+	}
+
+	srv.Inject(apollotest.Fault{Status: http.StatusBadGateway, Times: 2})
+	for range 2 {
+		if _, err := cli.ListOpsGroups(ctx); !errors.Is(err, apollo.BadGateway) {
+			t.Errorf("ListOpsGroups = %v, want BadGateway", err)
+		}
+	}
+	if _, err := cli.ListOpsGroups(ctx); err != nil {
+		t.Errorf("ListOpsGroups = %v after the fault", err)
+	}
+
+	// last, as the client waits for Retry-After before its next call.
+	srv.Inject(apollotest.Fault{Method: "query.ci.types", Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second})
+	_, err := cli.ListTypes(ctx)
+	var he *apollo.HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusTooManyRequests || he.RetryAfter != 2*time.Second {
+		t.Errorf("ListTypes = %v, want HTTP 429 with Retry-After 2s", err)
+	}
+
+	if n := len(srv.Calls()); n != 6 {
+		t.Errorf("Calls() has %d calls, want 6", n)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	cli, srv := newClient(t)
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	b := cli.NewBatch()
+	q := b.QueryResById(host.ID)
+	u := b.UpdateResById(host.ID, apollo.Attr{"cpu": 2})
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if r, err := q.Resource(); err != nil || r.ID != host.ID {
+		t.Errorf("query = %v, %v", r, err)
+	}
+	if ok, err := u.Bool(); err != nil || !ok {
+		t.Errorf("update = %v, %v", ok, err)
+	}
+
+	srv.DisableBatch()
+	b = cli.NewBatch()
+	q = b.QueryResById(host.ID)
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if r, err := q.Resource(); err != nil || r.ID != host.ID {
+		t.Errorf("query after the fallback = %v, %v", r, err)
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	srv := apollotest.NewServer("token")
+	defer srv.Close()
+
+	cfg := srv.Config()
+	cfg.Token = "other"
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if _, err = cli.ListTypes(context.Background()); !apollo.IsUnauthorized(err) {
+		t.Errorf("ListTypes = %v, want unauthorized", err)
+	}
+}
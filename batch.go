@@ -0,0 +1,285 @@
+package apollo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoResponse = errors.New("no response for batched call")
+	// ErrOutcomeUnknown is the error of the mutations of a batch whose
+	// response can't be read: they are not sent again, as they may have been
+	// applied.
+	ErrOutcomeUnknown = errors.New("outcome of batched call unknown")
+)
+
+// DefaultBatchConcurrency bounds the single calls sent when a server rejects
+// a batch.
+const DefaultBatchConcurrency = 8
+
+// Batch queues JSON-RPC calls and sends them as one JSON-RPC 2.0 batch
+// request. The calls don't go through the client middlewares. If the server
+// rejects batches, they are sent as concurrent single calls instead, which do.
+// If the response to the batch can't be read, only the query.* calls are sent
+// again and the other calls fail with ErrOutcomeUnknown.
+//
+//	b := cli.NewBatch()
+//	calls := make([]*apollo.BatchCall, 0, len(ids))
+//	for _, id := range ids {
+//		calls = append(calls, b.QueryResById(id))
+//	}
+//	err := b.Send(ctx)
+//	res, err := calls[0].Resource()
+type Batch struct {
+	c     *Client
+	calls []*BatchCall
+
+	// Concurrency bounds the single calls of the fallback,
+	// DefaultBatchConcurrency by default.
+	Concurrency int
+}
+
+// BatchCall is one call of a Batch. Its result is available once the batch
+// has been sent.
+type BatchCall struct {
+	Method string
+	Params map[string]any
+
+	Result json.RawMessage
+	Err    error
+
+	c  *Client
+	id int64
+}
+
+func (c *Client) NewBatch() *Batch {
+	return &Batch{c: c, Concurrency: DefaultBatchConcurrency}
+}
+
+// Add queues a call of method.
+func (b *Batch) Add(method string, params map[string]any) *BatchCall {
+	bc := &BatchCall{Method: method, Params: params, c: b.c}
+	b.calls = append(b.calls, bc)
+	return bc
+}
+
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+func (b *Batch) Calls() []*BatchCall {
+	return b.calls
+}
+
+func (b *Batch) QueryResById(id int64) *BatchCall {
+	return b.Add("query.resource", map[string]any{"id": id})
+}
+
+func (b *Batch) QueryResByTypeAndName(rType, name string) *BatchCall {
+	return b.Add("query.resource", map[string]any{"type": rType, "name": name})
+}
+
+func (b *Batch) Find(q *Query) *BatchCall {
+	if err := q.Validate(); err != nil {
+		bc := b.Add("query.resource", nil)
+		bc.Err = err
+		return bc
+	}
+	return b.Add("query.resource", q.params())
+}
+
+func (b *Batch) UpdateResById(id int64, attr Attr) *BatchCall {
+	return b.Add("update.resource", map[string]any{"id": id, "attributes": attr})
+}
+
+func (b *Batch) DeleteById(id int64) *BatchCall {
+	return b.Add("delete.resource", map[string]any{"id": id})
+}
+
+// Send sends the queued calls. The returned error is about the request as a
+// whole; the outcome of each call is in its Result and Err.
+func (b *Batch) Send(ctx context.Context) (err error) {
+	var pending []*BatchCall
+	for _, bc := range b.calls {
+		if bc.Err == nil && bc.Result == nil {
+			pending = append(pending, bc)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	c := b.c
+	var (
+		start = time.Now()
+		stats = CallStats{Method: "rpc.batch"}
+	)
+	ctx, end := c.startTrace(ctx, stats.Method, nil)
+	defer func() {
+		c.observe(&stats, start, err)
+		end(stats, err)
+	}()
+
+	reqs := make([]rpcRequest, 0, len(pending))
+	// label only lets the retry policy through when every call is a query.
+	label := "query.batch"
+	for _, bc := range pending {
+		req := c.newRequest(bc.Method, bc.Params)
+		bc.id = req.Id
+		reqs = append(reqs, req)
+		if !strings.HasPrefix(bc.Method, "query.") {
+			label = "batch"
+		}
+	}
+	reqBody, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+	p := payload{method: stats.Method, id: reqs[0].Id, body: reqBody}
+	stats.RequestBytes = len(reqBody)
+	if dl, ok := c.debugLogger(); ok {
+		dl.Debug("batch reqBody", "calls", len(reqs), "value", c.logPayload(reqs))
+	}
+
+	var respBody []byte
+	err = c.withRetry(ctx, label, func() error {
+		respBody, stats.Status, err = c.post(ctx, p)
+		return err
+	})
+	stats.ResponseBytes = len(respBody)
+	if err != nil && !rejectsBatch(err) {
+		c.log.Error(err, "fail to send batch", "calls", len(reqs))
+		return err
+	}
+	defer b.invalidate(pending)
+
+	if err != nil || rejectedBatch(respBody) {
+		err = nil
+		c.log.Info("apollo rejected the batch, fall back to single calls", "calls", len(reqs))
+		b.sendEach(ctx, pending, true)
+		return nil
+	}
+	var resps []Resp[json.RawMessage]
+	if !bytes.HasPrefix(bytes.TrimSpace(respBody), []byte("[")) || json.Unmarshal(respBody, &resps) != nil {
+		c.log.Error(ErrOutcomeUnknown, "fail to decode batch response, send the queries again", "calls", len(reqs))
+		b.sendEach(ctx, pending, false)
+		return nil
+	}
+
+	byID := make(map[int64]Resp[json.RawMessage], len(resps))
+	for _, r := range resps {
+		byID[r.Id] = r
+	}
+	for _, bc := range pending {
+		r, ok := byID[bc.id]
+		switch {
+		case !ok:
+			bc.Err = fmt.Errorf("%w: %s (id %d)", ErrNoResponse, bc.Method, bc.id)
+		case r.Error != nil:
+			bc.Err = r.Error
+		default:
+			bc.Result = r.Result
+		}
+	}
+	return nil
+}
+
+// rejectsBatch reports whether err is the HTTP status of a server that
+// doesn't accept batches.
+func rejectsBatch(err error) bool {
+	var he *HTTPError
+	return errors.As(err, &he) && (he.StatusCode == http.StatusBadRequest || he.StatusCode == http.StatusNotImplemented)
+}
+
+// rejectedBatch reports whether body is the single Invalid Request error, with
+// a null id, of a server that doesn't accept batches.
+func rejectedBatch(body []byte) bool {
+	var resp struct {
+		Id    json.RawMessage `json:"id"`
+		Error *RPCError       `json:"error"`
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) || json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return resp.Error != nil && resp.Error.Code == CodeInvalidRequest && (resp.Id == nil || string(resp.Id) == "null")
+}
+
+// sendEach sends calls one by one when their batch failed. The mutations are
+// only sent when the server rejected the batch, as they can't have been
+// applied then.
+func (b *Batch) sendEach(ctx context.Context, calls []*BatchCall, rejected bool) {
+	n := b.Concurrency
+	if n <= 0 {
+		n = DefaultBatchConcurrency
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, n)
+	)
+	for _, bc := range calls {
+		if !rejected && !strings.HasPrefix(bc.Method, "query.") {
+			bc.Err = fmt.Errorf("%w: %s (id %d)", ErrOutcomeUnknown, bc.Method, bc.id)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			bc.Result, bc.Err = b.c.call(ctx, bc.Method, bc.Params)
+		}()
+	}
+	wg.Wait()
+}
+
+// invalidate evicts the cache entries touched by the mutations of the batch,
+// which bypassed the cache middleware.
+func (b *Batch) invalidate(calls []*BatchCall) {
+	if b.c.cache == nil {
+		return
+	}
+	for _, bc := range calls {
+		if isMutation(bc.Method) {
+			b.c.cache.invalidate(mutationTags(bc.Params))
+		}
+	}
+}
+
+// Decode unmarshals the result of the call into v.
+func (bc *BatchCall) Decode(v any) error {
+	if bc.Err != nil {
+		return bc.Err
+	}
+	return bc.c.unmarshal(bc.Method, bc.Result, v)
+}
+
+func (bc *BatchCall) Resource() (*Resource, error) {
+	if bc.Err != nil {
+		return nil, bc.Err
+	}
+	return decode[*Resource](bc.c, bc.Method, bc.Result)
+}
+
+func (bc *BatchCall) Resources() ([]*Resource, error) {
+	if bc.Err != nil {
+		return nil, bc.Err
+	}
+	return decode[[]*Resource](bc.c, bc.Method, bc.Result)
+}
+
+func (bc *BatchCall) Bool() (bool, error) {
+	if bc.Err != nil {
+		return false, bc.Err
+	}
+	return decode[bool](bc.c, bc.Method, bc.Result)
+}
@@ -0,0 +1,191 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestBatch(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+	db01 := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	db02 := srv.AddResource(apollotest.Res("host", "db02", nil), "dba")
+
+	b := cli.NewBatch()
+	q1 := b.QueryResById(db01.ID)
+	q2 := b.QueryResByTypeAndName("host", "db02")
+	missing := b.QueryResById(db02.ID + 100)
+	bad := b.Add("query.nothing", nil)
+	del := b.DeleteById(db02.ID)
+	invalid := b.Find(apollo.NewQuery())
+	if b.Len() != 6 {
+		t.Fatalf("Len = %d, want 6", b.Len())
+	}
+
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if n := len(srv.Calls()); n != 5 {
+		t.Errorf("server got %d calls, want 5 without the invalid query", n)
+	}
+
+	if r, err := q1.Resource(); err != nil || r.ID != db01.ID {
+		t.Errorf("q1 = %v, %v", r, err)
+	}
+	if r, err := q2.Resource(); err != nil || r.ID != db02.ID {
+		t.Errorf("q2 = %v, %v", r, err)
+	}
+	if r, err := missing.Resource(); err != nil || r.ID != 0 {
+		t.Errorf("missing = %v, %v, want an empty resource", r, err)
+	}
+	if _, err := bad.Bool(); !errors.Is(err, apollo.ErrMethodNotFound) {
+		t.Errorf("bad = %v, want ErrMethodNotFound", err)
+	}
+	if ok, err := del.Bool(); err != nil || !ok {
+		t.Errorf("delete = %v, %v", ok, err)
+	}
+	if _, err := invalid.Resources(); !errors.Is(err, apollo.ErrInvalidQuery) {
+		t.Errorf("invalid = %v, want ErrInvalidQuery", err)
+	}
+
+	// sending again only sends the calls without a result.
+	if err := b.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Calls()); n != 5 {
+		t.Errorf("server got %d calls after a second Send, want 5", n)
+	}
+}
+
+func TestBatchFallback(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		reject func(*apollotest.Server)
+	}{
+		{"rpc error", (*apollotest.Server).DisableBatch},
+		{"http 400", func(srv *apollotest.Server) {
+			srv.Inject(apollotest.Fault{Status: http.StatusBadRequest, Times: 1})
+		}},
+		{"http 501", func(srv *apollotest.Server) {
+			srv.Inject(apollotest.Fault{Status: http.StatusNotImplemented, Times: 1})
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, srv := newTestClient(t, nil)
+			host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+			tt.reject(srv)
+
+			b := cli.NewBatch()
+			q := b.QueryResById(host.ID)
+			u := b.UpdateResById(host.ID, apollo.Attr{"cpu": 4})
+			if err := b.Send(context.Background()); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			if r, err := q.Resource(); err != nil || r.ID != host.ID {
+				t.Errorf("query = %v, %v", r, err)
+			}
+			// a rejected batch wasn't applied, so the update is sent again.
+			if ok, err := u.Bool(); err != nil || !ok {
+				t.Errorf("update = %v, %v", ok, err)
+			}
+			if n := calls(srv, "update.resource"); n != 1 {
+				t.Errorf("update sent %d times, want 1", n)
+			}
+			if r, _ := srv.Resource(host.ID); fmt.Sprint(r.Attrs["cpu"]) != "4" {
+				t.Errorf("update not applied by the fallback: %v", r.Attrs)
+			}
+		})
+	}
+}
+
+func TestBatchUnreadableResponse(t *testing.T) {
+	// the response to the batch, the first request, is garbled.
+	var requests atomic.Int32
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{func(next http.RoundTripper) http.RoundTripper {
+			return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				resp, err := next.RoundTrip(req)
+				if err == nil && requests.Add(1) == 1 {
+					resp.Body.Close()
+					resp.Body = io.NopCloser(strings.NewReader("<html>"))
+				}
+				return resp, err
+			})
+		}}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	b := cli.NewBatch()
+	q := b.QueryResById(host.ID)
+	u := b.UpdateResById(host.ID, apollo.Attr{"cpu": 4})
+	if err := b.Send(context.Background()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if r, err := q.Resource(); err != nil || r.ID != host.ID {
+		t.Errorf("query = %v, %v", r, err)
+	}
+	// the batch may have been applied, so the update isn't sent again.
+	if _, err := u.Bool(); !errors.Is(err, apollo.ErrOutcomeUnknown) {
+		t.Errorf("update = %v, want ErrOutcomeUnknown", err)
+	}
+	if n := calls(srv, "update.resource"); n != 1 {
+		t.Errorf("update sent %d times, want only in the batch", n)
+	}
+}
+
+func TestBatchRetry(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	ctx := context.Background()
+
+	srv.Inject(apollotest.Fault{Status: http.StatusServiceUnavailable, Times: 1})
+	b := cli.NewBatch()
+	q := b.QueryResById(host.ID)
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send of queries: %v", err)
+	}
+	if _, err := q.Resource(); err != nil {
+		t.Error(err)
+	}
+
+	srv.Inject(apollotest.Fault{Status: http.StatusServiceUnavailable, Times: 1})
+	b = cli.NewBatch()
+	b.QueryResById(host.ID)
+	b.DeleteById(host.ID)
+	var he *apollo.HTTPError
+	if err := b.Send(ctx); !errors.As(err, &he) || he.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Send with a mutation = %v, want HTTP 503 without retries", err)
+	}
+}
+
+func TestBatchInvalidatesCache(t *testing.T) {
+	cache := apollo.NewCache(apollo.CacheOptions{TTL: time.Minute})
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Cache = cache
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	ctx := context.Background()
+
+	_, _ = cli.QueryResById(ctx, host.ID)
+	b := cli.NewBatch()
+	b.UpdateResById(host.ID, apollo.Attr{"cpu": 4})
+	if err := b.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := cli.QueryResById(ctx, host.ID)
+	if err != nil || res.Attrs["cpu"] != float64(4) {
+		t.Errorf("QueryResById = %v, %v, want the batched update", res, err)
+	}
+}
@@ -0,0 +1,248 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("apollo circuit breaker is open")
+
+// BreakerPolicy configures the circuit breaker of a Client. It is disabled
+// unless ConsecutiveFailures or FailureRatio is set.
+//
+// Calls fail when the request can't be sent or the server answers with a 5xx
+// or 429 status. JSON-RPC errors, 501 Not Implemented (e.g. a rejected
+// batch), TokenSource errors and the calls canceled or timed out by their
+// context don't count.
+type BreakerPolicy struct {
+	// ConsecutiveFailures opens the circuit after that many failed calls in
+	// a row.
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit when the ratio of failed calls over
+	// Window reaches it, once MinCalls calls were made.
+	FailureRatio float64
+	// MinCalls defaults to 10.
+	MinCalls int
+	// Window defaults to 1 minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before letting probe
+	// requests through, 30 seconds by default.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of probe requests that must succeed to
+	// close the circuit again, 1 by default. A failed probe opens it again.
+	HalfOpenProbes int
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+func (p BreakerPolicy) enabled() bool {
+	return p.ConsecutiveFailures > 0 || p.FailureRatio > 0
+}
+
+type breaker struct {
+	policy BreakerPolicy
+	log    Logger
+
+	mu          sync.Mutex
+	state       BreakerState
+	openedAt    time.Time
+	consecutive int
+	// calls and failures are counted over the window started at windowStart.
+	calls, failures int
+	windowStart     time.Time
+	// probes is the number of probe requests let through while half-open,
+	// and succeeded the number of those that succeeded.
+	probes, succeeded int
+}
+
+// newBreaker returns nil when p is disabled. The methods of a nil breaker
+// let every call through.
+func newBreaker(p BreakerPolicy, log Logger) *breaker {
+	if !p.enabled() {
+		return nil
+	}
+	if p.MinCalls <= 0 {
+		p.MinCalls = 10
+	}
+	if p.Window <= 0 {
+		p.Window = time.Minute
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = 30 * time.Second
+	}
+	if p.HalfOpenProbes <= 0 {
+		p.HalfOpenProbes = 1
+	}
+	return &breaker{policy: p, log: log, windowStart: time.Now()}
+}
+
+// allow reports whether a call may be sent, and whether it is a probe.
+func (b *breaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if time.Since(b.openedAt) < b.policy.OpenTimeout {
+			return false, ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.policy.HalfOpenProbes {
+			return false, ErrCircuitOpen
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record reports the outcome of a call let through by allow. ctx is the
+// context of the call.
+func (b *breaker) record(ctx context.Context, probe bool, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if uninformative(ctx, err) {
+		// the call says nothing about the server, give its probe back.
+		if probe && b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		return
+	}
+
+	failed := isUnavailable(ctx, err)
+	switch b.state {
+	case BreakerHalfOpen:
+		if !probe {
+			return
+		}
+		if failed {
+			b.setState(BreakerOpen)
+			return
+		}
+		if b.succeeded++; b.succeeded >= b.policy.HalfOpenProbes {
+			b.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		if now := time.Now(); now.Sub(b.windowStart) > b.policy.Window {
+			b.windowStart = now
+			b.calls, b.failures = 0, 0
+		}
+		b.calls++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.consecutive++
+		b.failures++
+
+		p := b.policy
+		if (p.ConsecutiveFailures > 0 && b.consecutive >= p.ConsecutiveFailures) ||
+			(p.FailureRatio > 0 && b.calls >= p.MinCalls && float64(b.failures)/float64(b.calls) >= p.FailureRatio) {
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+func (b *breaker) setState(s BreakerState) {
+	from := b.state
+	b.state = s
+	b.probes, b.succeeded = 0, 0
+
+	switch s {
+	case BreakerOpen:
+		b.openedAt = time.Now()
+	case BreakerClosed:
+		b.consecutive = 0
+		b.calls, b.failures = 0, 0
+		b.windowStart = time.Now()
+	}
+	if s == BreakerOpen {
+		// logged as an error, so that loggers showing errors only report it.
+		b.log.Error(ErrCircuitOpen, "apollo circuit breaker state changed", "from", from, "to", s)
+		return
+	}
+	b.log.Info("apollo circuit breaker state changed", "from", from, "to", s)
+}
+
+func (b *breaker) current() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// BreakerState returns the state of the circuit breaker, BreakerClosed when
+// it is disabled.
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.current()
+}
+
+// uninformative reports whether err happened before the request reached
+// Apollo or was caused by the caller: the client was rate limited, the
+// TokenSource failed or ctx was canceled or timed out.
+func uninformative(ctx context.Context, err error) bool {
+	var te *tokenError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrRateLimited), errors.As(err, &te):
+		return true
+	}
+	return ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// isUnavailable reports whether err means Apollo couldn't serve the request,
+// as opposed to rejecting it: the request couldn't be sent, or the answer is
+// a 5xx status other than 501 or a 429.
+func isUnavailable(ctx context.Context, err error) bool {
+	var (
+		he *HTTPError
+		ue *url.Error
+	)
+	switch {
+	case err == nil, uninformative(ctx, err):
+		return false
+	case errors.As(err, &he):
+		return (he.StatusCode >= 500 && he.StatusCode != http.StatusNotImplemented) || he.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.As(err, &ue)
+}
@@ -0,0 +1,241 @@
+package apollo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+// hang is a transport middleware holding every request until its context is
+// done.
+func hang(http.RoundTripper) http.RoundTripper {
+	return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+}
+
+type failingToken struct{}
+
+func (failingToken) Token(context.Context) (string, error) {
+	return "", errors.New("vault is sealed")
+}
+
+func TestBreakerOpens(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 2, OpenTimeout: time.Hour}
+	})
+	var cmdb apollo.CMDB = cli
+
+	srv.Inject(apollotest.Fault{Status: http.StatusInternalServerError})
+	for range 2 {
+		if _, err := cli.ListTypes(context.Background()); err == nil {
+			t.Fatal("ListTypes succeeded")
+		}
+	}
+	if s := cmdb.BreakerState(); s != apollo.BreakerOpen {
+		t.Fatalf("state = %v, want open", s)
+	}
+
+	srv.ClearFaults()
+	before := len(srv.Calls())
+	if _, err := cli.ListTypes(context.Background()); !errors.Is(err, apollo.ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := len(srv.Calls()) - before; n != 0 {
+		t.Errorf("%d requests sent through an open circuit", n)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: 20 * time.Millisecond}
+	})
+	srv.AddType("host")
+
+	srv.Inject(apollotest.Fault{Status: http.StatusBadGateway, Times: 2})
+	_, _ = cli.ListTypes(context.Background())
+	if s := cli.BreakerState(); s != apollo.BreakerOpen {
+		t.Fatalf("state = %v, want open", s)
+	}
+
+	// A failed probe opens the circuit again.
+	time.Sleep(30 * time.Millisecond)
+	if _, err := cli.ListTypes(context.Background()); errors.Is(err, apollo.ErrCircuitOpen) || err == nil {
+		t.Fatalf("probe err = %v, want the 502", err)
+	}
+	if s := cli.BreakerState(); s != apollo.BreakerOpen {
+		t.Fatalf("state after a failed probe = %v, want open", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := cli.ListTypes(context.Background()); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if s := cli.BreakerState(); s != apollo.BreakerClosed {
+		t.Errorf("state after a successful probe = %v, want closed", s)
+	}
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Breaker = apollo.BreakerPolicy{FailureRatio: 0.5, MinCalls: 4, OpenTimeout: time.Hour}
+	})
+	srv.AddType("host")
+
+	for range 2 {
+		if _, err := cli.ListTypes(context.Background()); err != nil {
+			t.Fatalf("ListTypes: %v", err)
+		}
+	}
+	srv.Inject(apollotest.Fault{Status: http.StatusTooManyRequests})
+	_, _ = cli.ListTypes(context.Background())
+	if s := cli.BreakerState(); s != apollo.BreakerClosed {
+		t.Fatalf("state after 3 calls = %v, want closed", s)
+	}
+	_, _ = cli.ListTypes(context.Background())
+	if s := cli.BreakerState(); s != apollo.BreakerOpen {
+		t.Errorf("state after 2 failures in 4 calls = %v, want open", s)
+	}
+}
+
+func TestBreakerIgnores(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*apollo.Config)
+		fault *apollotest.Fault
+		call  func(*apollo.Client) error
+	}{
+		{
+			name:  "rpc error",
+			setup: func(*apollo.Config) {},
+			fault: &apollotest.Fault{RPC: &apollo.RPCError{Code: apollo.CodeInvalidParams, Message: "bad"}},
+			call: func(cli *apollo.Client) error {
+				_, err := cli.ListTypes(context.Background())
+				return err
+			},
+		},
+		{
+			name: "token error",
+			setup: func(c *apollo.Config) {
+				c.TokenSource = failingToken{}
+			},
+			call: func(cli *apollo.Client) error {
+				_, err := cli.ListTypes(context.Background())
+				return err
+			},
+		},
+		{
+			name: "caller deadline",
+			setup: func(c *apollo.Config) {
+				c.TransportMiddlewares = []apollo.TransportMiddleware{hang}
+			},
+			call: func(cli *apollo.Client) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+				defer cancel()
+				_, err := cli.ListTypes(ctx)
+				return err
+			},
+		},
+		{
+			name: "caller cancel",
+			setup: func(c *apollo.Config) {
+				c.TransportMiddlewares = []apollo.TransportMiddleware{hang}
+			},
+			call: func(cli *apollo.Client) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(5*time.Millisecond, cancel)
+				_, err := cli.ListTypes(ctx)
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, srv := newTestClient(t, func(c *apollo.Config) {
+				c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Hour}
+				tt.setup(c)
+			})
+			if tt.fault != nil {
+				srv.Inject(*tt.fault)
+			}
+			for range 3 {
+				if err := tt.call(cli); err == nil {
+					t.Fatal("call succeeded")
+				}
+			}
+			if s := cli.BreakerState(); s != apollo.BreakerClosed {
+				t.Errorf("state = %v, want closed", s)
+			}
+		})
+	}
+}
+
+func TestBreakerCountsClientTimeout(t *testing.T) {
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Timeout = 5 * time.Millisecond
+		c.TransportMiddlewares = []apollo.TransportMiddleware{hang}
+		c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Hour}
+	})
+
+	if _, err := cli.ListTypes(context.Background()); err == nil {
+		t.Fatal("ListTypes succeeded")
+	}
+	if s := cli.BreakerState(); s != apollo.BreakerOpen {
+		t.Errorf("state = %v, want open", s)
+	}
+}
+
+func TestBreakerIgnoresRejectedBatch(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		reject func(*apollotest.Server)
+	}{
+		{"rpc error", (*apollotest.Server).DisableBatch},
+		{"http 501", func(srv *apollotest.Server) {
+			srv.Inject(apollotest.Fault{Status: http.StatusNotImplemented, Times: 1})
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, srv := newTestClient(t, func(c *apollo.Config) {
+				c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Hour}
+			})
+			host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+			tt.reject(srv)
+
+			b := cli.NewBatch()
+			q := b.QueryResById(host.ID)
+			if err := b.Send(context.Background()); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if _, err := q.Resource(); err != nil {
+				t.Errorf("fallback query = %v", err)
+			}
+			if s := cli.BreakerState(); s != apollo.BreakerClosed {
+				t.Errorf("state = %v, want closed", s)
+			}
+		})
+	}
+}
+
+func TestBreakerLogsOpen(t *testing.T) {
+	var buf bytes.Buffer
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Logger = apollo.PrintfLogger(log.New(&buf, "", 0))
+		c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Hour}
+	})
+
+	srv.Inject(apollotest.Fault{Status: http.StatusBadGateway})
+	_, _ = cli.ListTypes(context.Background())
+	if out := buf.String(); !strings.Contains(out, "circuit breaker state changed") || !strings.Contains(out, "to=open") {
+		t.Errorf("opening not logged by a logger showing errors only:\n%s", out)
+	}
+}
@@ -0,0 +1,167 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrBulkAborted is the error of the items a bulk operation didn't run
+// because it stopped on the first error.
+var ErrBulkAborted = errors.New("bulk operation aborted")
+
+// DefaultBulkWorkers is the number of concurrent calls of bulk operations.
+const DefaultBulkWorkers = 8
+
+// BulkOptions configures the Bulk* methods of Client.
+type BulkOptions struct {
+	// Workers bounds the concurrent calls, DefaultBulkWorkers by default.
+	Workers int
+	// StopOnError stops starting items after the first failed one. The calls
+	// in flight run to completion and the items not started yet fail with
+	// ErrBulkAborted.
+	StopOnError bool
+}
+
+// BulkResult holds the outcome of every item of a bulk operation, by id.
+type BulkResult[T any] struct {
+	Succeeded map[int64]T
+	Failed    map[int64]error
+}
+
+// Err joins the errors of the failed items, ordered by id, or returns nil.
+func (r *BulkResult[T]) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(r.Failed))
+	for _, id := range slices.Sorted(maps.Keys(r.Failed)) {
+		errs = append(errs, fmt.Errorf("id %d: %w", id, r.Failed[id]))
+	}
+	return errors.Join(errs...)
+}
+
+// BulkUpdate calls UpdateResById for each entry of attrs. A false result
+// fails the item with ErrNotUpdated.
+func (c *Client) BulkUpdate(ctx context.Context, attrs map[int64]Attr, opts BulkOptions) (*BulkResult[bool], error) {
+	ids := slices.Sorted(maps.Keys(attrs))
+	return bulk(ctx, ids, opts, updated(func(ctx context.Context, id int64) (bool, error) {
+		return c.UpdateResById(ctx, id, attrs[id])
+	}))
+}
+
+// BulkDelete calls DeleteById for each of ids. A false result fails the item
+// with ErrNotUpdated.
+func (c *Client) BulkDelete(ctx context.Context, ids []int64, opts BulkOptions) (*BulkResult[bool], error) {
+	return bulk(ctx, ids, opts, updated(c.DeleteById))
+}
+
+// BulkDeliver calls DeliverRes for each of ids. A false result fails the item
+// with ErrNotUpdated.
+func (c *Client) BulkDeliver(ctx context.Context, targetGroup string, ids []int64, opts BulkOptions) (*BulkResult[bool], error) {
+	return bulk(ctx, ids, opts, updated(func(ctx context.Context, id int64) (bool, error) {
+		return c.DeliverRes(ctx, targetGroup, id)
+	}))
+}
+
+// BulkQueryByIds calls QueryResById for each of ids. Use a Batch to query
+// them in a single request when the server supports it.
+func (c *Client) BulkQueryByIds(ctx context.Context, ids []int64, opts BulkOptions) (*BulkResult[*Resource], error) {
+	return bulk(ctx, ids, opts, c.QueryResById)
+}
+
+// updated turns the false results of a mutation into ErrNotUpdated errors.
+func updated(fn func(context.Context, int64) (bool, error)) func(context.Context, int64) (bool, error) {
+	return func(ctx context.Context, id int64) (bool, error) {
+		ok, err := fn(ctx, id)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: resource %d", ErrNotUpdated, id)
+		}
+		return ok, err
+	}
+}
+
+// bulk calls fn for each of ids with opts.Workers goroutines. The returned
+// error is the one of BulkResult.Err.
+func bulk[T any](ctx context.Context, ids []int64, opts BulkOptions, fn func(context.Context, int64) (T, error)) (*BulkResult[T], error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBulkWorkers
+	}
+	workers = min(workers, len(ids))
+
+	var (
+		res = &BulkResult[T]{
+			Succeeded: make(map[int64]T, len(ids)),
+			Failed:    make(map[int64]error),
+		}
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		queue = make(chan int64)
+		// stop is closed on the first error with StopOnError. Unlike a
+		// canceled ctx, it lets the calls in flight complete.
+		stop     = make(chan struct{})
+		stopOnce sync.Once
+	)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for id := range queue {
+				var (
+					v   T
+					err error
+				)
+				select {
+				case <-stop:
+					err = ErrBulkAborted
+				default:
+					v, err = fn(ctx, id)
+				}
+
+				mu.Lock()
+				if err != nil {
+					res.Failed[id] = err
+				} else {
+					res.Succeeded[id] = v
+				}
+				mu.Unlock()
+
+				if err != nil && opts.StopOnError {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+
+	var (
+		next  = 0
+		cause error
+	)
+send:
+	for _, id := range ids {
+		select {
+		case queue <- id:
+			next++
+		case <-stop:
+			cause = ErrBulkAborted
+			break send
+		case <-ctx.Done():
+			cause = ctx.Err()
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, id := range ids[next:] {
+		res.Failed[id] = cause
+	}
+	return res, res.Err()
+}
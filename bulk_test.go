@@ -0,0 +1,210 @@
+package apollo_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestBulkUpdate(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	db01 := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	db02 := srv.AddResource(apollotest.Res("host", "db02", nil), "dba")
+
+	res, err := cli.BulkUpdate(context.Background(), map[int64]apollo.Attr{
+		db01.ID: {"cpu": 8},
+		db02.ID: {"cpu": 16},
+	}, apollo.BulkOptions{})
+	if err != nil {
+		t.Fatalf("BulkUpdate: %v", err)
+	}
+	if len(res.Succeeded) != 2 || len(res.Failed) != 0 {
+		t.Fatalf("result = %+v, want 2 successes", res)
+	}
+	for id, cpu := range map[int64]float64{db01.ID: 8, db02.ID: 16} {
+		got, _ := srv.Resource(id)
+		if got.Attrs["cpu"] != cpu {
+			t.Errorf("resource %d cpu = %v, want %v", id, got.Attrs["cpu"], cpu)
+		}
+	}
+}
+
+func TestBulkNotUpdated(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	srv.AddGroup(apollo.OpsGroup{Name: "dba"})
+	srv.AddGroup(apollo.OpsGroup{Name: "sre"})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	const missing = 999
+
+	tests := []struct {
+		name string
+		run  func() (*apollo.BulkResult[bool], error)
+	}{
+		{"update", func() (*apollo.BulkResult[bool], error) {
+			return cli.BulkUpdate(context.Background(), map[int64]apollo.Attr{host.ID: {"cpu": 8}, missing: {"cpu": 8}}, apollo.BulkOptions{})
+		}},
+		{"deliver", func() (*apollo.BulkResult[bool], error) {
+			return cli.BulkDeliver(context.Background(), "sre", []int64{host.ID, missing}, apollo.BulkOptions{})
+		}},
+		{"delete", func() (*apollo.BulkResult[bool], error) {
+			return cli.BulkDelete(context.Background(), []int64{host.ID, missing}, apollo.BulkOptions{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.run()
+			if !errors.Is(err, apollo.ErrNotUpdated) {
+				t.Fatalf("err = %v, want ErrNotUpdated", err)
+			}
+			if !res.Succeeded[host.ID] {
+				t.Errorf("resource %d not succeeded: %+v", host.ID, res)
+			}
+			if !errors.Is(res.Failed[missing], apollo.ErrNotUpdated) {
+				t.Errorf("missing resource error = %v, want ErrNotUpdated", res.Failed[missing])
+			}
+		})
+	}
+}
+
+func TestBulkQueryByIds(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	db01 := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	db02 := srv.AddResource(apollotest.Res("host", "db02", nil), "dba")
+
+	res, err := cli.BulkQueryByIds(context.Background(), []int64{db01.ID, db02.ID}, apollo.BulkOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("BulkQueryByIds: %v", err)
+	}
+	if res.Succeeded[db01.ID].Attrs["name"] != "db01" || res.Succeeded[db02.ID].Attrs["name"] != "db02" {
+		t.Errorf("result = %+v", res.Succeeded)
+	}
+}
+
+func TestBulkStopOnError(t *testing.T) {
+	const missing = 999
+
+	var (
+		slowStarted = make(chan struct{})
+		slowErr     = make(chan error, 1)
+		slowID      int64
+	)
+	hold := func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			var rpc struct {
+				Params struct {
+					ID int64 `json:"id"`
+				} `json:"params"`
+			}
+			_ = json.Unmarshal(body, &rpc)
+
+			switch rpc.Params.ID {
+			case missing:
+				// Fail only once the other call is in flight.
+				<-slowStarted
+			case slowID:
+				close(slowStarted)
+				select {
+				case <-req.Context().Done():
+				case <-time.After(100 * time.Millisecond):
+				}
+				slowErr <- req.Context().Err()
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{hold}
+	})
+	slow := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	rest := srv.AddResource(apollotest.Res("host", "db02", nil), "dba")
+	slowID = slow.ID
+
+	res, err := cli.BulkDelete(context.Background(), []int64{missing, slow.ID, rest.ID},
+		apollo.BulkOptions{Workers: 2, StopOnError: true})
+	if err == nil {
+		t.Fatal("BulkDelete succeeded")
+	}
+	if err := <-slowErr; err != nil {
+		t.Errorf("in-flight call canceled: %v", err)
+	}
+	if !res.Succeeded[slow.ID] {
+		t.Errorf("in-flight delete failed: %v", res.Failed[slow.ID])
+	}
+	if !errors.Is(res.Failed[missing], apollo.ErrNotUpdated) {
+		t.Errorf("missing resource error = %v, want ErrNotUpdated", res.Failed[missing])
+	}
+	if !errors.Is(res.Failed[rest.ID], apollo.ErrBulkAborted) {
+		t.Errorf("queued resource error = %v, want ErrBulkAborted", res.Failed[rest.ID])
+	}
+	if _, ok := srv.Resource(rest.ID); !ok {
+		t.Error("queued resource deleted after the failure")
+	}
+}
+
+func TestBulkCanceled(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ids := make([]int64, 0, 4)
+	for _, name := range []string{"db01", "db02", "db03", "db04"} {
+		ids = append(ids, srv.AddResource(apollotest.Res("host", name, nil), "dba").ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := cli.BulkDelete(ctx, ids, apollo.BulkOptions{Workers: 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(res.Failed) != len(ids) {
+		t.Errorf("%d items failed, want %d", len(res.Failed), len(ids))
+	}
+	for _, id := range ids {
+		if _, ok := srv.Resource(id); !ok {
+			t.Errorf("resource %d deleted", id)
+		}
+	}
+}
+
+func TestBulkWorkers(t *testing.T) {
+	var inflight, peak atomic.Int32
+	count := func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			n := inflight.Add(1)
+			defer inflight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return next.RoundTrip(req)
+		})
+	}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{count}
+	})
+	ids := make([]int64, 0, 10)
+	for i := range 10 {
+		ids = append(ids, srv.AddResource(apollotest.Res("host", "db"+strconv.Itoa(i), nil), "dba").ID)
+	}
+
+	if _, err := cli.BulkQueryByIds(context.Background(), ids, apollo.BulkOptions{Workers: 3}); err != nil {
+		t.Fatalf("BulkQueryByIds: %v", err)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d concurrent calls, want at most 3", p)
+	}
+}
@@ -0,0 +1,449 @@
+package apollo
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures a Cache.
+type CacheOptions struct {
+	// MaxEntries bounds the cache, the least recently used entries are
+	// evicted first. It defaults to 10000.
+	MaxEntries int
+	// TTL is the lifetime of the results of query.* methods.
+	TTL time.Duration
+	// MethodTTL overrides TTL per method. A negative duration disables the
+	// cache for the method.
+	MethodTTL map[string]time.Duration
+	// StaleIfError keeps entries that long past their TTL, to be served when
+	// Apollo is unavailable: the circuit breaker is open, the request can't be
+	// sent or fails with a 5xx or 429 status.
+	StaleIfError time.Duration
+}
+
+// Cache is a read cache of JSON-RPC results keyed on method and params.
+// Concurrent identical queries share one request, and successful or failed
+// mutations (create.*, update.*, delete.*) evict the entries of the resources
+// they touch by id and by type/name.
+//
+//	cache := apollo.NewCache(apollo.CacheOptions{TTL: time.Minute})
+//	cfg.Cache = cache
+type Cache struct {
+	opts CacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{}
+	// known maps the ids seen in results to their type/name tags, so that
+	// mutations by id also evict the entries found by type/name.
+	known   map[int64][]string
+	flights map[string]*flight
+	// gen is bumped by every invalidation, so that the results of the
+	// requests started before one aren't cached.
+	gen uint64
+}
+
+type cacheEntry struct {
+	key     string
+	result  json.RawMessage
+	expires time.Time
+	tags    []string
+}
+
+type flight struct {
+	done   chan struct{}
+	result json.RawMessage
+	err    error
+	// waiters is the number of callers waiting for the flight, which is
+	// canceled when the last of them leaves.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+const defaultCacheEntries = 10000
+
+func NewCache(opts CacheOptions) *Cache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheEntries
+	}
+	return &Cache{
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+		known:   make(map[int64][]string),
+		flights: make(map[string]*flight),
+	}
+}
+
+// Middleware serves query.* calls from the cache and evicts entries after
+// mutations.
+func (c *Cache) Middleware() Middleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+			if isMutation(method) {
+				r, err := next(ctx, method, params)
+				c.invalidate(mutationTags(params))
+				return r, err
+			}
+
+			ttl := c.ttl(method)
+			if ttl <= 0 {
+				return next(ctx, method, params)
+			}
+
+			key, err := cacheKey(method, params)
+			if err != nil {
+				return next(ctx, method, params)
+			}
+			return c.load(ctx, key, ttl, method, params, next)
+		}
+	}
+}
+
+// Len returns the number of cached entries, expired ones included.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Purge drops every entry.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	clear(c.entries)
+	clear(c.tags)
+	clear(c.known)
+	c.gen++
+}
+
+// InvalidateID drops the entries of the resource id.
+func (c *Cache) InvalidateID(id int64) {
+	c.invalidate([]string{idTag(id)})
+}
+
+// InvalidateType drops the entries of resources of rType.
+func (c *Cache) InvalidateType(rType string) {
+	c.invalidate([]string{typeTag(rType)})
+}
+
+func (c *Cache) ttl(method string) time.Duration {
+	if ttl, ok := c.opts.MethodTTL[method]; ok {
+		return ttl
+	}
+	if strings.HasPrefix(method, "query.") {
+		return c.opts.TTL
+	}
+	return 0
+}
+
+// load serves key from the cache or runs next once for all the concurrent
+// callers. The shared request doesn't inherit the cancellation of the caller
+// that started it; each caller stops waiting when its own ctx is done, and the
+// request is canceled once none is left.
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, method string, params map[string]any, next Invoker) (json.RawMessage, error) {
+	c.mu.Lock()
+	if r, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return r, nil
+	}
+	f, ok := c.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[key] = f
+		go c.fly(fctx, f, c.gen, key, ttl, method, params, next)
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		c.leave(key, f)
+		return nil, ctx.Err()
+	}
+}
+
+// leave cancels f when the caller leaving was its last waiter, and lets the
+// next caller of key start a new flight.
+func (c *Cache) leave(key string, f *flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.waiters--; f.waiters > 0 {
+		return
+	}
+	f.cancel()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
+
+// fly runs the request of a flight. Its result isn't cached when the cache
+// was invalidated since gen, as it may predate the mutation.
+func (c *Cache) fly(ctx context.Context, f *flight, gen uint64, key string, ttl time.Duration, method string, params map[string]any, next Invoker) {
+	defer close(f.done)
+	defer f.cancel()
+
+	f.result, f.err = next(ctx, method, params)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	if f.err == nil {
+		if c.gen == gen {
+			tags, refs := queryTags(method, params, f.result)
+			c.set(key, f.result, ttl, tags)
+			c.learn(refs)
+		}
+	} else if errors.Is(f.err, ErrCircuitOpen) || isUnavailable(ctx, f.err) {
+		if r, ok := c.stale(key); ok {
+			f.result, f.err = r, nil
+		}
+	}
+}
+
+func (c *Cache) get(key string) (json.RawMessage, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if now := time.Now(); now.After(e.expires) {
+		if now.After(e.expires.Add(c.opts.StaleIfError)) {
+			c.remove(el)
+		}
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.result, true
+}
+
+// stale returns the expired entry of key if it is within StaleIfError.
+func (c *Cache) stale(key string) (json.RawMessage, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires.Add(c.opts.StaleIfError)) {
+		return nil, false
+	}
+	return e.result, true
+}
+
+func (c *Cache) set(key string, r json.RawMessage, ttl time.Duration, tags []string) {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	e := &cacheEntry{key: key, result: r, expires: time.Now().Add(ttl), tags: tags}
+	c.entries[key] = c.lru.PushFront(e)
+	for _, t := range tags {
+		if c.tags[t] == nil {
+			c.tags[t] = make(map[string]struct{})
+		}
+		c.tags[t][key] = struct{}{}
+	}
+
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	for _, t := range e.tags {
+		delete(c.tags[t], e.key)
+		if len(c.tags[t]) == 0 {
+			delete(c.tags, t)
+		}
+	}
+}
+
+func (c *Cache) learn(refs []resRef) {
+	if len(c.known) > 4*c.opts.MaxEntries {
+		clear(c.known)
+	}
+	for _, ref := range refs {
+		if ref.ID != 0 && ref.Type.Name != "" {
+			c.known[ref.ID] = ref.tags(true)[1:]
+		}
+	}
+}
+
+func (c *Cache) invalidate(tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for i := 0; i < len(tags); i++ {
+		var id int64
+		if _, err := fmt.Sscanf(tags[i], "id:%d", &id); err == nil {
+			tags = append(tags, c.known[id]...)
+			delete(c.known, id)
+		}
+	}
+
+	for _, t := range append(tags, allTag) {
+		for key := range c.tags[t] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+			}
+		}
+	}
+}
+
+func isMutation(method string) bool {
+	return strings.HasPrefix(method, "create.") ||
+		strings.HasPrefix(method, "update.") ||
+		strings.HasPrefix(method, "delete.")
+}
+
+func cacheKey(method string, params map[string]any) (string, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return method + " " + string(raw), nil
+}
+
+// allTag marks the entries that any mutation may change, such as aggregates.
+const allTag = "*"
+
+func idTag(id int64) string {
+	return fmt.Sprintf("id:%d", id)
+}
+
+func typeTag(rType string) string {
+	return "type:" + rType
+}
+
+func nameTag(rType, name string) string {
+	return "name:" + rType + "/" + name
+}
+
+// resRef is the part of a resource used to tag cache entries.
+type resRef struct {
+	ID    int64 `json:"id"`
+	Type  RType `json:"type"`
+	Attrs struct {
+		Name string `json:"name"`
+	} `json:"attributes"`
+}
+
+// tags returns the id and type/name tags of r, and its type tag when withType
+// is set.
+func (r resRef) tags(withType bool) []string {
+	var tags []string
+	if r.ID != 0 {
+		tags = append(tags, idTag(r.ID))
+	}
+	if r.Type.Name != "" && r.Attrs.Name != "" {
+		tags = append(tags, nameTag(r.Type.Name, r.Attrs.Name))
+	}
+	if r.Type.Name != "" && withType {
+		tags = append(tags, typeTag(r.Type.Name))
+	}
+	return tags
+}
+
+// paramTags tags a call by the resources named in its params. The type tags
+// are only set with withType, so that a lookup by id or type/name isn't
+// evicted by the mutations of other resources of the same type.
+func paramTags(params map[string]any, withType bool) []string {
+	var tags []string
+	for _, k := range []string{"id", "referenced_id"} {
+		if id, ok := params[k].(int64); ok {
+			tags = append(tags, idTag(id))
+		}
+	}
+	if t, ok := params["type"].(string); ok {
+		if n, ok := params["name"].(string); ok {
+			tags = append(tags, nameTag(t, n))
+		}
+	}
+	if withType {
+		for _, k := range []string{"type", "primary_type", "secondary_type"} {
+			if t, ok := params[k].(string); ok {
+				tags = append(tags, typeTag(t))
+			}
+		}
+	}
+	return tags
+}
+
+// queryTags returns the tags of a query result and the resources it holds.
+func queryTags(method string, params map[string]any, r json.RawMessage) ([]string, []resRef) {
+	if method != "query.resource" && method != "query.ci.ops.group" {
+		return []string{allTag}, nil
+	}
+
+	_, byID := params["id"]
+	_, byName := params["name"]
+	list := !byID && !(byName && params["type"] != nil)
+
+	tags := paramTags(params, list)
+	if method != "query.resource" {
+		return tags, nil
+	}
+
+	refs := resultRefs(r)
+	for _, ref := range refs {
+		tags = append(tags, ref.tags(false)...)
+	}
+	return tags, refs
+}
+
+// mutationTags returns the tags of the entries a mutation may change.
+func mutationTags(params map[string]any) []string {
+	tags := paramTags(params, true)
+
+	var refs []resRef
+	for _, k := range []string{"resource", "resources"} {
+		if v, ok := params[k]; ok {
+			raw, err := json.Marshal(v)
+			if err == nil {
+				refs = append(refs, resultRefs(raw)...)
+			}
+		}
+	}
+	for _, ref := range refs {
+		tags = append(tags, ref.tags(true)...)
+	}
+	return tags
+}
+
+func resultRefs(r json.RawMessage) []resRef {
+	var refs []resRef
+	if err := json.Unmarshal(r, &refs); err == nil {
+		return refs
+	}
+
+	var ref resRef
+	if err := json.Unmarshal(r, &ref); err == nil {
+		return []resRef{ref}
+	}
+	return nil
+}
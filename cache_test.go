@@ -0,0 +1,275 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func newCachedClient(t *testing.T, opts apollo.CacheOptions, setup func(*apollo.Config)) (*apollo.Client, *apollotest.Server, *apollo.Cache) {
+	t.Helper()
+
+	cache := apollo.NewCache(opts)
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Cache = cache
+		if setup != nil {
+			setup(c)
+		}
+	})
+	return cli, srv, cache
+}
+
+func TestCacheHit(t *testing.T) {
+	cli, srv, cache := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute}, nil)
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	for range 3 {
+		res, err := cli.QueryResById(ctx, host.ID)
+		if err != nil || res.ID != host.ID {
+			t.Fatalf("QueryResById = %v, %v", res, err)
+		}
+	}
+	if n := calls(srv, "query.resource"); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Len = %d, want 1", cache.Len())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	cli, srv, _ := newCachedClient(t, apollo.CacheOptions{
+		TTL:       time.Minute,
+		MethodTTL: map[string]time.Duration{"query.ci.types": 10 * time.Millisecond, "query.ops.group": -1},
+	}, nil)
+	ctx := context.Background()
+	srv.AddType("host")
+
+	_, _ = cli.ListTypes(ctx)
+	_, _ = cli.ListTypes(ctx)
+	time.Sleep(20 * time.Millisecond)
+	_, _ = cli.ListTypes(ctx)
+	if n := calls(srv, "query.ci.types"); n != 2 {
+		t.Errorf("query.ci.types requests = %d, want 2", n)
+	}
+
+	_, _ = cli.ListOpsGroups(ctx)
+	_, _ = cli.ListOpsGroups(ctx)
+	if n := calls(srv, "query.ops.group"); n != 2 {
+		t.Errorf("query.ops.groups requests = %d, want 2 with the cache disabled", n)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	cli, srv, cache := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute, MaxEntries: 2}, nil)
+	ctx := context.Background()
+	var ids []int64
+	for i := range 3 {
+		ids = append(ids, srv.AddResource(apollotest.Res("host", fmt.Sprintf("h%d", i), nil), "dba").ID)
+	}
+
+	_, _ = cli.QueryResById(ctx, ids[0])
+	_, _ = cli.QueryResById(ctx, ids[1])
+	_, _ = cli.QueryResById(ctx, ids[0]) // ids[1] is now the least recently used.
+	_, _ = cli.QueryResById(ctx, ids[2])
+	if cache.Len() != 2 {
+		t.Errorf("Len = %d, want 2", cache.Len())
+	}
+
+	before := calls(srv, "query.resource")
+	_, _ = cli.QueryResById(ctx, ids[0])
+	if calls(srv, "query.resource") != before {
+		t.Error("the recently used entry was evicted")
+	}
+	_, _ = cli.QueryResById(ctx, ids[1])
+	if calls(srv, "query.resource") != before+1 {
+		t.Error("the least recently used entry wasn't evicted")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	cli, srv, cache := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute}, nil)
+	ctx := context.Background()
+	db01 := srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"cpu": 8}), "dba")
+	db02 := srv.AddResource(apollotest.Res("host", "db02", nil), "dba")
+
+	_, _ = cli.QueryResById(ctx, db01.ID)
+	_, _ = cli.QueryResByTypeAndName(ctx, "host", "db01")
+	_, _ = cli.QueryResById(ctx, db02.ID)
+	_, _ = cli.QueryResByType(ctx, "host")
+
+	if _, err := cli.UpdateResById(ctx, db01.ID, apollo.Attr{"cpu": 16}); err != nil {
+		t.Fatal(err)
+	}
+	// db01 by id, by name and the host list are evicted, not db02.
+	if cache.Len() != 1 {
+		t.Errorf("Len = %d after the update, want 1", cache.Len())
+	}
+	res, err := cli.QueryResByTypeAndName(ctx, "host", "db01")
+	if err != nil || res.Attrs["cpu"] != float64(16) {
+		t.Errorf("QueryResByTypeAndName = %v, %v, want the updated cpu", res, err)
+	}
+
+	_, _ = cli.QueryResByType(ctx, "host")
+	before := calls(srv, "query.resource")
+	cache.InvalidateType("host")
+	_, _ = cli.QueryResByType(ctx, "host")
+	if calls(srv, "query.resource") != before+1 {
+		t.Error("the host list was served from the cache after InvalidateType")
+	}
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("Len = %d after Purge", cache.Len())
+	}
+}
+
+// gate is a transport middleware holding the requests until it is opened.
+type gate struct {
+	started chan struct{}
+	open    chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{started: make(chan struct{}, 16), open: make(chan struct{})}
+}
+
+func (g *gate) middleware(next http.RoundTripper) http.RoundTripper {
+	return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		g.started <- struct{}{}
+		<-g.open
+		return next.RoundTrip(req)
+	})
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	g := newGate()
+	cli, srv, _ := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute}, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{g.middleware}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cli.QueryResById(leaderCtx, host.ID)
+		leaderErr <- err
+	}()
+	<-g.started
+
+	var (
+		wg      sync.WaitGroup
+		results = make(chan error, 4)
+	)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := cli.QueryResById(context.Background(), host.ID)
+			if err == nil && res.ID != host.ID {
+				err = fmt.Errorf("got resource %d", res.ID)
+			}
+			results <- err
+		}()
+	}
+
+	// the leader giving up must not fail the calls waiting on its request.
+	time.Sleep(20 * time.Millisecond)
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader = %v, want context.Canceled", err)
+	}
+	close(g.open)
+	wg.Wait()
+	close(results)
+	for err := range results {
+		if err != nil {
+			t.Errorf("follower = %v", err)
+		}
+	}
+	if n := calls(srv, "query.resource"); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestCacheCancelsAbandonedFlight(t *testing.T) {
+	canceled := make(chan struct{})
+	cli, srv, _ := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute}, func(c *apollo.Config) {
+		c.Timeout = 0
+		c.TransportMiddlewares = []apollo.TransportMiddleware{func(http.RoundTripper) http.RoundTripper {
+			return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				canceled <- struct{}{}
+				return nil, req.Context().Err()
+			})
+		}}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := cli.QueryResById(ctx, host.ID)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+		// the last caller leaving cancels the request, and the next one
+		// starts another.
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("the request of the abandoned flight is still running")
+		}
+	}
+}
+
+func TestCacheSkipsResultsOfInvalidatedFlights(t *testing.T) {
+	g := newGate()
+	cli, srv, cache := newCachedClient(t, apollo.CacheOptions{TTL: time.Minute}, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{g.middleware}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cli.QueryResById(context.Background(), host.ID)
+	}()
+	<-g.started
+	cache.InvalidateID(host.ID)
+	close(g.open)
+	<-done
+
+	if cache.Len() != 0 {
+		t.Errorf("Len = %d, the result read before the invalidation was cached", cache.Len())
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	cli, srv, _ := newCachedClient(t, apollo.CacheOptions{TTL: 10 * time.Millisecond, StaleIfError: time.Minute}, nil)
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	if _, err := cli.QueryResById(ctx, host.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusServiceUnavailable, Times: 1})
+	res, err := cli.QueryResById(ctx, host.ID)
+	if err != nil || res.ID != host.ID {
+		t.Errorf("QueryResById = %v, %v, want the stale entry", res, err)
+	}
+
+	srv.FailNext("query.resource", apollo.CodeInvalidParams, "bad id")
+	if _, err = cli.QueryResById(ctx, host.ID); !errors.Is(err, apollo.ErrInvalidParams) {
+		t.Errorf("QueryResById = %v, want the RPC error, not the stale entry", err)
+	}
+}
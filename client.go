@@ -4,29 +4,85 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
 type Client struct {
-	url   string
-	token string
+	url    string
+	tokens TokenSource
 
 	log     Logger
 	timeout time.Duration
+	retry   RetryPolicy
+	schemas map[string][]string
 	client  *http.Client
+	// stream is client without its overall timeout, for the responses read
+	// while they are iterated.
+	stream  *http.Client
+	metrics Metrics
+	tracer  Tracer
+	limiter *limiter
+	breaker *breaker
+
+	lifecycle *Lifecycle
+
+	middlewares []Middleware
+	invoke      Invoker
+
+	redactKeys  []string
+	maxLogBytes int
+
+	ids   atomic.Int64
+	cache *Cache
 }
 
 func NewClient(c Config) (*Client, error) {
-	if c.Url == "" || c.Token == "" {
+	if c.Url == "" || (c.Token == "" && c.TokenSource == nil) {
 		return nil, errors.New("url or token is empty")
 	}
+	if c.TokenSource == nil {
+		c.TokenSource = StaticToken(c.Token)
+	}
+
+	if c.Lifecycle == nil {
+		c.Lifecycle = DefaultLifecycle()
+	}
+	if c.RedactKeys == nil {
+		c.RedactKeys = DefaultRedactKeys
+	}
+	if c.MaxLogBytes == 0 {
+		c.MaxLogBytes = DefaultMaxLogBytes
+	}
 
 	cli := &Client{
 		url:     c.Url,
-		token:   c.Token,
+		tokens:  c.TokenSource,
 		timeout: c.Timeout,
 		log:     c.Logger,
-		client:  &http.Client{Timeout: c.Timeout},
+		retry:   c.Retry,
+		schemas: c.Schemas,
+		client:  newHTTPClient(c),
+		metrics: c.Metrics,
+		tracer:  c.Tracer,
+		limiter: newLimiter(c.RateLimit),
+
+		lifecycle: c.Lifecycle,
+
+		redactKeys:  c.RedactKeys,
+		maxLogBytes: c.MaxLogBytes,
+	}
+
+	stream := *cli.client
+	stream.Timeout = 0
+	cli.stream = &stream
+
+	cli.breaker = newBreaker(c.Breaker, cli.log)
+	cli.invoke = cli.do
+	cli.Use(c.Middlewares...)
+	if c.Cache != nil {
+		cli.cache = c.Cache
+		cli.Use(c.Cache.Middleware())
 	}
 
 	cli.log.Info("apollo client created", "url", cli.url)
@@ -47,7 +103,7 @@ func (c *Client) QueryResById(ctx context.Context, id int64) (*Resource, error)
 		c.log.Error(err, "fail to query resource by id", "id", id)
 		return nil, err
 	}
-	return c.handleResp(r)
+	return decode[*Resource](c, "query.resource", r)
 }
 
 func (c *Client) QueryResByTypeAndName(ctx context.Context, rType, name string) (*Resource, error) {
@@ -63,118 +119,39 @@ func (c *Client) QueryResByTypeAndName(ctx context.Context, rType, name string)
 		c.log.Error(err, "fail to query resource by type and name", "type", rType, "name", name)
 		return nil, err
 	}
-	return c.handleResp(r)
+	return decode[*Resource](c, "query.resource", r)
 }
 
 func (c *Client) QueryResByType(ctx context.Context, rType string) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"type": rType,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by type", "type", rType)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().Type(rType))
 }
 
 func (c *Client) QueryResByGraphAndTarget(ctx context.Context, graph, target string) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"graph":  graph,
-			"target": target,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by graph and target", "graph", graph, "target", target)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().Graph(graph).Target(target))
 }
 
 func (c *Client) QueryResByName(ctx context.Context, name string) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"name": name,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by name", "name", name)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().Name(name))
 }
 
 func (c *Client) QueryResByGroupAndType(ctx context.Context, rType, group string) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"type":       rType,
-			"group_name": group,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by type and group", "type", rType, "group", group)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().Type(rType).Group(group))
 }
 
 func (c *Client) QueryResByTypeAndCondition(ctx context.Context, rType string, cond map[string]any) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"type":       rType,
-			"conditions": cond,
-		}
-	)
+	return c.Find(ctx, NewQuery().Type(rType).Where(Raw(cond)))
+}
 
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by type and conditions", "type", rType, "conditions", cond)
-		return nil, err
-	}
-	return c.handleResps(r)
+func (c *Client) QueryResByTypeAndCond(ctx context.Context, rType string, cond Cond) ([]*Resource, error) {
+	return c.Find(ctx, NewQuery().Type(rType).Where(cond))
 }
 
 func (c *Client) QueryResByTypeAndRelationship(ctx context.Context, pType, relationship, sType string) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"primary_type":   pType,
-			"relationship":   relationship,
-			"secondary_type": sType,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by pType/relationship/sType",
-			"type", pType, "relationship", relationship, "secondary_type", sType)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().Type(pType).Relationship(relationship, sType))
 }
 
 func (c *Client) QueryResByReferId(ctx context.Context, id int64) ([]*Resource, error) {
-	var (
-		params = map[string]any{
-			"referenced_id": id,
-		}
-	)
-
-	r, err := c.call(ctx, "query.resource", params)
-	if err != nil {
-		c.log.Error(err, "fail to query resource by referId", "ReferId", id)
-		return nil, err
-	}
-	return c.handleResps(r)
+	return c.Find(ctx, NewQuery().ReferencedBy(id))
 }
 
 func (c *Client) ListTypes(ctx context.Context) ([]string, error) {
@@ -187,7 +164,7 @@ func (c *Client) ListTypes(ctx context.Context) ([]string, error) {
 		c.log.Error(err, "fail to list types")
 		return nil, err
 	}
-	return c.handleListStr(r)
+	return decode[[]string](c, "query.ci.types", r)
 }
 
 func (c *Client) ListOpsGroups(ctx context.Context) ([]string, error) {
@@ -200,7 +177,7 @@ func (c *Client) ListOpsGroups(ctx context.Context) ([]string, error) {
 		c.log.Error(err, "fail to list ops groups")
 		return nil, err
 	}
-	return c.handleListStr(r)
+	return decode[[]string](c, "query.ops.group", r)
 }
 
 func (c *Client) ListOpsGroupsWithUser(ctx context.Context, user string) ([]string, error) {
@@ -215,7 +192,7 @@ func (c *Client) ListOpsGroupsWithUser(ctx context.Context, user string) ([]stri
 		c.log.Error(err, "fail to list ops groups", "username", user)
 		return nil, err
 	}
-	return c.handleListStr(r)
+	return decode[[]string](c, "query.ops.group", r)
 }
 
 func (c *Client) ListUsers(ctx context.Context, group string) ([]string, error) {
@@ -230,7 +207,7 @@ func (c *Client) ListUsers(ctx context.Context, group string) ([]string, error)
 		c.log.Error(err, "fail to list users", "group", group)
 		return nil, err
 	}
-	return c.handleListStr(r)
+	return decode[[]string](c, "query.ops.group.members", r)
 }
 
 func (c *Client) QueryOpsGroupOwner(ctx context.Context, group string) (string, error) {
@@ -245,7 +222,7 @@ func (c *Client) QueryOpsGroupOwner(ctx context.Context, group string) (string,
 		c.log.Error(err, "fail to query ops group owner", "group", group)
 		return "", err
 	}
-	return c.handleStr(r)
+	return decode[string](c, "query.ops.group.owner", r)
 }
 
 func (c *Client) QueryAggRes(ctx context.Context, graph string, fields [][]string) (*AggRes, error) {
@@ -261,7 +238,7 @@ func (c *Client) QueryAggRes(ctx context.Context, graph string, fields [][]strin
 		c.log.Error(err, "fail to query aggregate resource", "graph", graph, "fields", fields)
 		return nil, err
 	}
-	return c.handleAgg(r)
+	return decode[*AggRes](c, "query.aggregate", r)
 }
 
 func (c *Client) QueryAggResWithGroup(ctx context.Context, graph, group string, fields [][]string) (*AggRes, error) {
@@ -278,7 +255,7 @@ func (c *Client) QueryAggResWithGroup(ctx context.Context, graph, group string,
 		c.log.Error(err, "fail to query aggregate resource", "graph", graph, "fields", fields)
 		return nil, err
 	}
-	return c.handleAgg(r)
+	return decode[*AggRes](c, "query.aggregate", r)
 }
 
 func (c *Client) QueryAggResLeftJoin(ctx context.Context, graph, root string, fields []string) (*AggResLeftJoin, error) {
@@ -295,7 +272,7 @@ func (c *Client) QueryAggResLeftJoin(ctx context.Context, graph, root string, fi
 		c.log.Error(err, "fail to query aggregate left join resource", "graph", graph, "fields", fields)
 		return nil, err
 	}
-	return c.handleAggLeft(r)
+	return decode[*AggResLeftJoin](c, "query.aggregate", r)
 }
 
 func (c *Client) QueryResOpsGroupById(ctx context.Context, id int64) (*OpsGroup, error) {
@@ -310,7 +287,7 @@ func (c *Client) QueryResOpsGroupById(ctx context.Context, id int64) (*OpsGroup,
 		c.log.Error(err, "fail to query ops group", "id", id)
 		return nil, err
 	}
-	return c.handleOpsGroup(r)
+	return decode[*OpsGroup](c, "query.ci.ops.group", r)
 }
 
 func (c *Client) QueryResOpsGroupByTypeAndName(ctx context.Context, rType, name string) (*OpsGroup, error) {
@@ -326,7 +303,7 @@ func (c *Client) QueryResOpsGroupByTypeAndName(ctx context.Context, rType, name
 		c.log.Error(err, "fail to query resource ops group by type and name", "type", rType, "name", name)
 		return nil, err
 	}
-	return c.handleOpsGroup(r)
+	return decode[*OpsGroup](c, "query.ci.ops.group", r)
 }
 
 // --------- CRUD ---------
@@ -341,10 +318,10 @@ func (c *Client) CreateRes(ctx context.Context, res Resource, group string) (*Re
 
 	r, err := c.call(ctx, "create.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to create resource", "resource", res, "group", group)
+		c.log.Error(err, "fail to create resource", "resource", c.logPayload(res), "group", group)
 		return nil, err
 	}
-	return c.handleResp(r)
+	return decode[*Resource](c, "create.resource", r)
 }
 
 func (c *Client) CreateResLst(ctx context.Context, resLst []Resource, group string) (bool, error) {
@@ -357,10 +334,10 @@ func (c *Client) CreateResLst(ctx context.Context, resLst []Resource, group stri
 
 	r, err := c.call(ctx, "create.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to create resources", "resources", resLst, "group", group)
+		c.log.Error(err, "fail to create resources", "resources", c.logPayload(resLst), "group", group)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "create.resource", r)
 }
 
 func (c *Client) UpdateRes(ctx context.Context, res Resource) (bool, error) {
@@ -372,10 +349,10 @@ func (c *Client) UpdateRes(ctx context.Context, res Resource) (bool, error) {
 
 	r, err := c.call(ctx, "update.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to update resource", "resource", res)
+		c.log.Error(err, "fail to update resource", "resource", c.logPayload(res))
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.resource", r)
 }
 
 func (c *Client) UpdateResLst(ctx context.Context, resLst []Resource) (bool, error) {
@@ -387,10 +364,10 @@ func (c *Client) UpdateResLst(ctx context.Context, resLst []Resource) (bool, err
 
 	r, err := c.call(ctx, "update.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to update resources", "resources", resLst)
+		c.log.Error(err, "fail to update resources", "resources", c.logPayload(resLst))
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.resource", r)
 }
 
 func (c *Client) UpdateResById(ctx context.Context, id int64, attr Attr) (bool, error) {
@@ -403,10 +380,10 @@ func (c *Client) UpdateResById(ctx context.Context, id int64, attr Attr) (bool,
 
 	r, err := c.call(ctx, "update.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to update resource", "id", id, "attributes", attr)
+		c.log.Error(err, "fail to update resource", "id", id, "attributes", c.logPayload(attr))
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.resource", r)
 }
 
 func (c *Client) UpdateResByTypeAndName(ctx context.Context, rtype, name string, attr Attr) (bool, error) {
@@ -423,7 +400,7 @@ func (c *Client) UpdateResByTypeAndName(ctx context.Context, rtype, name string,
 		c.log.Error(err, "fail to update res by type and name", "type", rtype, "name", name)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.resource", r)
 }
 
 func (c *Client) UpdateResRel(ctx context.Context, id int64, rels Rel, mode string) (bool, error) {
@@ -437,10 +414,10 @@ func (c *Client) UpdateResRel(ctx context.Context, id int64, rels Rel, mode stri
 
 	r, err := c.call(ctx, "update.resource", params)
 	if err != nil {
-		c.log.Error(err, "fail to update resource relations", "id", id, "rels", rels, "mode", mode)
+		c.log.Error(err, "fail to update resource relations", "id", id, "rels", c.logPayload(rels), "mode", mode)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.resource", r)
 }
 
 func (c *Client) DeliverRes(ctx context.Context, targetGroup string, id int64) (bool, error) {
@@ -456,7 +433,7 @@ func (c *Client) DeliverRes(ctx context.Context, targetGroup string, id int64) (
 		c.log.Error(err, "fail to deliver resource", "targetGroup", targetGroup, "id", id)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "update.ci.ops.group", r)
 }
 
 func (c *Client) DeleteById(ctx context.Context, id int64) (bool, error) {
@@ -471,7 +448,7 @@ func (c *Client) DeleteById(ctx context.Context, id int64) (bool, error) {
 		c.log.Error(err, "fail to delete resource", "id", id)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "delete.resource", r)
 }
 
 func (c *Client) DeleteByTypeAndName(ctx context.Context, rtype, name string) (bool, error) {
@@ -487,5 +464,31 @@ func (c *Client) DeleteByTypeAndName(ctx context.Context, rtype, name string) (b
 		c.log.Error(err, "fail to delete resource", "type", rtype, "name", name)
 		return false, err
 	}
-	return c.handleBool(r)
+	return decode[bool](c, "delete.resource", r)
+}
+
+// --------- INVOKE ---------
+
+// Invoke calls a JSON-RPC method the Client has no method for, and decodes
+// its result into a T. It goes through the same middlewares, retries and
+// error handling as the other methods. When T is a pointer, a null result
+// decodes to a pointer to a zero value.
+//
+//	type Audit struct {
+//		User string `json:"user"`
+//		Op   string `json:"op"`
+//	}
+//	audits, err := apollo.Invoke[[]Audit](ctx, cli, "query.audit", map[string]any{"id": id})
+func Invoke[T any](ctx context.Context, c *Client, method string, params map[string]any) (T, error) {
+	if params == nil {
+		params = map[string]any{}
+	}
+
+	r, err := c.call(ctx, method, params)
+	if err != nil {
+		c.log.Error(err, "fail to invoke apollo method", "method", method, "params", c.logPayload(params))
+		var zero T
+		return zero, err
+	}
+	return decode[T](c, method, r)
 }
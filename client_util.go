@@ -4,154 +4,231 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"reflect"
+	"time"
 )
 
-func (c *Client) call(ctx context.Context, method string, params map[string]any) ([]byte, error) {
-	body := map[string]any{
-		"method":  method,
-		"params":  params,
-		"jsonrpc": "2.0",
-		"id":      0,
-	}
-	reqBody, err := json.MarshalIndent(body, "", "	")
-	if err != nil {
-		return nil, err
-	}
-	c.log.Info("reqBody", "value", string(reqBody))
+// call sends a JSON-RPC request through the middlewares and returns the raw
+// result member of the response.
+func (c *Client) call(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+	return c.invoke(ctx, method, params)
+}
+
+// do is the Invoker at the bottom of the middleware chain. A JSON-RPC error
+// object is returned as *RPCError.
+func (c *Client) do(ctx context.Context, method string, params map[string]any) (_ json.RawMessage, err error) {
+	var (
+		start = time.Now()
+		stats = CallStats{Method: method}
+	)
+	defer func() {
+		c.observe(&stats, start, err)
+	}()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(reqBody))
+	req, err := c.encode(method, params)
 	if err != nil {
 		return nil, err
 	}
+	stats.RequestBytes = len(req.body)
 
-	req.Header.Set("token", c.token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(req)
+	var respBody []byte
+	err = c.withRetry(ctx, method, func() error {
+		respBody, stats.Status, err = c.post(ctx, req)
+		return err
+	})
+	stats.ResponseBytes = len(respBody)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	//c.log.Info("response", "value", string(respBody))
 
-	if resp.StatusCode == http.StatusBadGateway {
-		return nil, BadGateway
+	var rpcResp Resp[json.RawMessage]
+	if err = json.Unmarshal(respBody, &rpcResp); err != nil {
+		c.log.Error(err, "apollo response is not json-rpc", "method", method)
+		return nil, &DecodeError{Method: method, Payload: truncate(string(respBody), maxErrorBody), Err: err}
 	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if rpcResp.Error != nil {
+		return nil, rpcResp.Error
 	}
-	//c.log.Info("response", "value", string(respBody))
-	return respBody, nil
+	return rpcResp.Result, nil
 }
 
-func (c *Client) Close() {
-	c.client.CloseIdleConnections()
+type rpcRequest struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      int64          `json:"id"`
+	Method  string         `json:"method"`
+	Params  map[string]any `json:"params"`
 }
 
-func (c *Client) handleResp(r []byte) (*Resource, error) {
-	var resp Resp[Resource]
-	err := json.Unmarshal(r, &resp)
-	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
-	}
-
-	resource := resp.Result
-	if resource.Rel == nil {
-		resource.Rel = make(map[string][]Resource)
-	}
-
-	return &resource, nil
+func (c *Client) newRequest(method string, params map[string]any) rpcRequest {
+	return rpcRequest{Jsonrpc: "2.0", Id: c.ids.Add(1), Method: method, Params: params}
 }
 
-func (c *Client) handleResps(r []byte) ([]*Resource, error) {
-	var (
-		resp Resp[[]Resource]
-		res  = make([]*Resource, 0)
-	)
+// payload is an encoded JSON-RPC request.
+type payload struct {
+	method string
+	id     int64
+	body   []byte
+	// stream sends the request without the overall timeout of the client,
+	// which then bounds the wait for each chunk of the response instead.
+	stream bool
+}
 
-	err := json.Unmarshal(r, &resp)
+func (c *Client) encode(method string, params map[string]any) (payload, error) {
+	req := c.newRequest(method, params)
+	reqBody, err := json.MarshalIndent(req, "", "	")
 	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
+		return payload{}, err
 	}
 
-	for _, re := range resp.Result {
-		if re.Rel == nil {
-			re.Rel = make(map[string][]Resource)
-		}
+	if dl, ok := c.debugLogger(); ok {
+		dl.Debug("reqBody", "method", method, "params", c.logPayload(params))
+	}
+	return payload{method: method, id: req.Id, body: reqBody}, nil
+}
 
-		res = append(res, &re)
+// post sends a single HTTP request and reads the response body. It also
+// returns the HTTP status, 0 if none was received.
+func (c *Client) post(ctx context.Context, p payload) ([]byte, int, error) {
+	resp, err := c.send(ctx, p)
+	if err != nil {
+		return nil, statusOf(err), err
 	}
+	defer resp.Body.Close()
 
-	return res, nil
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
 }
 
-func (c *Client) handleListStr(r []byte) ([]string, error) {
-	var resp Resp[[]string]
+// send sends a single HTTP request. The caller must close the response body.
+// A 401 or 403 response invalidates the token and the request is sent again
+// once with a fresh one.
+func (c *Client) send(ctx context.Context, p payload) (*http.Response, error) {
+	resp, err := c.sendOnce(ctx, p)
 
-	err := json.Unmarshal(r, &resp)
-	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
+	var he *HTTPError
+	if errors.As(err, &he) && (he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden) {
+		if inv, ok := c.tokens.(TokenInvalidator); ok {
+			inv.Invalidate()
+			c.log.Info("apollo token rejected, refresh it", "status", he.StatusCode)
+
+			return c.sendOnce(ctx, p)
+		}
 	}
-	return resp.Result, nil
+	return resp, err
 }
 
-func (c *Client) handleStr(r []byte) (string, error) {
-	var resp Resp[string]
-
-	err := json.Unmarshal(r, &resp)
+// sendOnce sends a single HTTP request. Non-2xx responses are returned as
+// *HTTPError.
+func (c *Client) sendOnce(ctx context.Context, p payload) (*http.Response, error) {
+	token, err := c.tokens.Token(ctx)
 	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return "", JsonMarshalFailed
+		c.log.Error(err, "fail to get apollo token")
+		return nil, &tokenError{err: err}
 	}
-	return resp.Result, nil
-}
 
-func (c *Client) handleAgg(r []byte) (*AggRes, error) {
-	var resp Resp[AggRes]
+	hc := c.client
+	var idle *idleTimeout
+	if p.stream {
+		hc = c.stream
+		if c.client.Timeout > 0 {
+			ctx, idle = withIdleTimeout(ctx, c.client.Timeout)
+		}
+	}
 
-	err := json.Unmarshal(r, &resp)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(p.body))
 	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
+		idle.stop()
+		return nil, err
 	}
-	return &resp.Result, nil
-}
 
-func (c *Client) handleAggLeft(r []byte) (*AggResLeftJoin, error) {
-	var resp Resp[AggResLeftJoin]
+	req.Header.Set("token", token)
+	req.Header.Set("Content-Type", "application/json")
 
-	err := json.Unmarshal(r, &resp)
+	resp, err := hc.Do(req)
 	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
+		idle.stop()
+		return nil, idle.wrap(err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if idle != nil {
+			// the consumer's time between reads doesn't count.
+			idle.timer.Stop()
+			resp.Body = &idleBody{rc: resp.Body, idle: idle}
+		}
+		return resp, nil
+	}
+	defer idle.stop()
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+	he := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       truncate(string(bytes.TrimSpace(body)), maxErrorBody),
+		Method:     p.method,
+		RequestID:  p.id,
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		he.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+		if he.RetryAfter > 0 {
+			c.limiter.pause(he.RetryAfter)
+			c.log.Info("apollo asked to slow down, pause requests", "status", resp.StatusCode, "retryAfter", he.RetryAfter)
+		}
 	}
-	return &resp.Result, nil
+	return nil, he
 }
 
-func (c *Client) handleBool(r []byte) (bool, error) {
-	var resp Resp[bool]
+func (c *Client) Close() {
+	c.client.CloseIdleConnections()
+}
 
-	err := json.Unmarshal(r, &resp)
-	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return false, JsonMarshalFailed
+// decode unmarshals the result r of method into a T. Resources get a non-nil
+// Rel, a null resource list decodes to an empty one and a null result to a
+// pointer to a zero value, so that callers never get (nil, nil).
+func decode[T any](c *Client, method string, r json.RawMessage) (T, error) {
+	var v T
+	if err := c.unmarshal(method, r, &v); err != nil {
+		return v, err
 	}
-	return resp.Result, nil
+
+	switch p := any(&v).(type) {
+	case **Resource:
+		if *p == nil {
+			*p = &Resource{}
+		}
+		initRel(*p)
+	case *[]*Resource:
+		if *p == nil {
+			*p = make([]*Resource, 0)
+		}
+		for _, re := range *p {
+			initRel(re)
+		}
+	default:
+		if rv := reflect.ValueOf(p).Elem(); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+	}
+	return v, nil
 }
 
-func (c *Client) handleOpsGroup(r []byte) (*OpsGroup, error) {
-	var resp Resp[OpsGroup]
+func (c *Client) unmarshal(method string, r json.RawMessage, v any) error {
+	if err := json.Unmarshal(r, v); err != nil {
+		c.log.Error(err, "fail to decode apollo result", "method", method)
+		return &DecodeError{Method: method, Payload: truncate(string(r), maxErrorBody), Err: err}
+	}
+	return nil
+}
 
-	err := json.Unmarshal(r, &resp)
-	if err != nil {
-		c.log.Error(err, "apollo query resource failed")
-		return nil, JsonMarshalFailed
+func initRel(re *Resource) {
+	if re != nil && re.Rel == nil {
+		re.Rel = make(map[string][]Resource)
 	}
-	return &resp.Result, nil
+}
+
+func isNull(r json.RawMessage) bool {
+	return len(r) == 0 || string(r) == "null"
 }
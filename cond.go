@@ -0,0 +1,266 @@
+package apollo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Cond is an attribute condition of query.resource. Conditions marshal to the
+// "conditions" param: an equality is a plain {"attr": value} pair, the same
+// shape accepted by QueryResByTypeAndCondition, and the other operators are
+// {"attr": {"$op": value}} documents. And merges its operands into one object
+// when their attributes don't overlap and falls back to {"$and": [...]}.
+//
+//	cond := apollo.And(
+//		apollo.Eq("idc", "sh-01"),
+//		apollo.In("state", apollo.Online, apollo.OnJob),
+//		apollo.Not(apollo.Like("name", "test-%")),
+//	)
+type Cond interface {
+	json.Marshaler
+	fmt.Stringer
+
+	// Fields returns the attribute names referenced by the condition.
+	Fields() []string
+}
+
+var ErrUnknownField = errors.New("unknown attribute")
+
+func Eq(field string, value any) Cond {
+	return cmpCond{field: field, op: "=", value: value}
+}
+
+func In(field string, values ...any) Cond {
+	return cmpCond{field: field, op: "in", value: values}
+}
+
+// Like matches a SQL-like pattern where % matches any sequence.
+func Like(field, pattern string) Cond {
+	return cmpCond{field: field, op: "like", value: pattern}
+}
+
+func Gt(field string, value any) Cond {
+	return cmpCond{field: field, op: "gt", value: value}
+}
+
+func Gte(field string, value any) Cond {
+	return cmpCond{field: field, op: "gte", value: value}
+}
+
+func Lt(field string, value any) Cond {
+	return cmpCond{field: field, op: "lt", value: value}
+}
+
+func Lte(field string, value any) Cond {
+	return cmpCond{field: field, op: "lte", value: value}
+}
+
+func And(conds ...Cond) Cond {
+	return logicCond{op: "and", conds: conds}
+}
+
+func Or(conds ...Cond) Cond {
+	return logicCond{op: "or", conds: conds}
+}
+
+func Not(cond Cond) Cond {
+	return notCond{cond: cond}
+}
+
+// Match turns a raw conditions map into a Cond, each pair being an equality.
+func Match(m map[string]any) Cond {
+	conds := make([]Cond, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		conds = append(conds, Eq(k, m[k]))
+	}
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return And(conds...)
+}
+
+// Raw sends a conditions map to Apollo exactly as given, operators included,
+// where Match rewrites it into equalities. A nil map is sent as null.
+func Raw(m map[string]any) Cond {
+	return rawCond{m: m}
+}
+
+// ValidateCond checks that every attribute used by cond is one of fields.
+func ValidateCond(cond Cond, fields []string) error {
+	for _, f := range cond.Fields() {
+		if !slices.Contains(fields, f) {
+			return fmt.Errorf("%w %q in %s", ErrUnknownField, f, cond)
+		}
+	}
+	return nil
+}
+
+type cmpCond struct {
+	field string
+	op    string
+	value any
+}
+
+var cmpSymbols = map[string]string{
+	"=":    "=",
+	"in":   "IN",
+	"like": "LIKE",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+}
+
+func (c cmpCond) MarshalJSON() ([]byte, error) {
+	if c.op == "=" {
+		return json.Marshal(map[string]any{c.field: c.value})
+	}
+	return json.Marshal(map[string]any{c.field: map[string]any{"$" + c.op: c.value}})
+}
+
+func (c cmpCond) String() string {
+	if c.op == "in" {
+		values := c.value.([]any)
+		items := make([]string, 0, len(values))
+		for _, v := range values {
+			items = append(items, formatCondValue(v))
+		}
+		return fmt.Sprintf("%s IN (%s)", c.field, strings.Join(items, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", c.field, cmpSymbols[c.op], formatCondValue(c.value))
+}
+
+func (c cmpCond) Fields() []string {
+	return []string{c.field}
+}
+
+type logicCond struct {
+	op    string
+	conds []Cond
+}
+
+func (c logicCond) MarshalJSON() ([]byte, error) {
+	if c.op == "and" {
+		if merged, ok := c.merge(); ok {
+			return json.Marshal(merged)
+		}
+	}
+	return json.Marshal(map[string]any{"$" + c.op: c.conds})
+}
+
+// merge flattens an And of equalities on distinct attributes into one object.
+func (c logicCond) merge() (map[string]any, bool) {
+	merged := make(map[string]any, len(c.conds))
+	for _, cond := range c.conds {
+		raw, err := json.Marshal(cond)
+		if err != nil {
+			return nil, false
+		}
+		var m map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &m); err != nil {
+			return nil, false
+		}
+		for k, v := range m {
+			if _, dup := merged[k]; dup || isCondOperator(k) {
+				return nil, false
+			}
+			merged[k] = v
+		}
+	}
+	return merged, true
+}
+
+// isCondOperator reports whether k is an operator key of the DSL, as opposed
+// to an attribute name, which may start with "$" too.
+func isCondOperator(k string) bool {
+	switch k {
+	case "$and", "$or", "$not", "$in", "$like", "$gt", "$gte", "$lt", "$lte":
+		return true
+	}
+	return false
+}
+
+func (c logicCond) String() string {
+	items := make([]string, 0, len(c.conds))
+	for _, cond := range c.conds {
+		s := cond.String()
+		if l, ok := cond.(logicCond); ok && l.op != c.op && len(l.conds) > 1 {
+			s = "(" + s + ")"
+		}
+		items = append(items, s)
+	}
+	return strings.Join(items, " "+strings.ToUpper(c.op)+" ")
+}
+
+func (c logicCond) Fields() []string {
+	var fields []string
+	for _, cond := range c.conds {
+		for _, f := range cond.Fields() {
+			if !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+type rawCond struct {
+	m map[string]any
+}
+
+func (c rawCond) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.m)
+}
+
+func (c rawCond) String() string {
+	b, err := json.Marshal(c.m)
+	if err != nil {
+		return fmt.Sprintf("%v", c.m)
+	}
+	return string(b)
+}
+
+// Fields returns the top-level attributes of the map, the ones nested in
+// operators aren't known.
+func (c rawCond) Fields() []string {
+	var fields []string
+	for _, k := range slices.Sorted(maps.Keys(c.m)) {
+		if !isCondOperator(k) {
+			fields = append(fields, k)
+		}
+	}
+	return fields
+}
+
+type notCond struct {
+	cond Cond
+}
+
+func (c notCond) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"$not": c.cond})
+}
+
+func (c notCond) String() string {
+	if _, ok := c.cond.(logicCond); ok {
+		return "NOT (" + c.cond.String() + ")"
+	}
+	return "NOT " + c.cond.String()
+}
+
+func (c notCond) Fields() []string {
+	return c.cond.Fields()
+}
+
+func formatCondValue(v any) string {
+	switch s := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", s)
+	case fmt.Stringer:
+		return fmt.Sprintf("%q", s.String())
+	}
+	return fmt.Sprintf("%v", v)
+}
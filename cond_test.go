@@ -0,0 +1,119 @@
+package apollo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestCondJSON(t *testing.T) {
+	tests := []struct {
+		cond apollo.Cond
+		want string
+	}{
+		{apollo.Eq("idc", "sh"), `{"idc":"sh"}`},
+		{apollo.Gt("cpu", 4), `{"cpu":{"$gt":4}}`},
+		{apollo.And(apollo.Eq("idc", "sh"), apollo.Eq("cpu", 8)), `{"cpu":8,"idc":"sh"}`},
+		{apollo.And(apollo.Eq("idc", "sh"), apollo.Eq("idc", "bj")), `{"$and":[{"idc":"sh"},{"idc":"bj"}]}`},
+		{apollo.Or(apollo.Eq("idc", "sh"), apollo.In("cpu", 4, 8)), `{"$or":[{"idc":"sh"},{"cpu":{"$in":[4,8]}}]}`},
+		{apollo.And(apollo.Eq("idc", "sh"), apollo.Not(apollo.Eq("cpu", 8))), `{"$and":[{"idc":"sh"},{"$not":{"cpu":8}}]}`},
+		{apollo.Match(map[string]any{"$region": "east", "idc": "sh"}), `{"$region":"east","idc":"sh"}`},
+		{apollo.Raw(map[string]any{"$or": []any{map[string]any{"cpu": 4}}, "idc": "x"}), `{"$or":[{"cpu":4}],"idc":"x"}`},
+		{apollo.Raw(nil), `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond.String(), func(t *testing.T) {
+			got, err := json.Marshal(tt.cond)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCondString(t *testing.T) {
+	cond := apollo.And(
+		apollo.Eq("idc", "sh"),
+		apollo.Or(apollo.Gte("cpu", 8), apollo.Like("name", "db%")),
+		apollo.Not(apollo.In("state", "a", "b")),
+	)
+	want := `idc = "sh" AND (cpu >= 8 OR name LIKE "db%") AND NOT state IN ("a", "b")`
+	if got := cond.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestValidateCond(t *testing.T) {
+	cond := apollo.And(apollo.Eq("idc", "sh"), apollo.Gt("mem", 4))
+	if err := apollo.ValidateCond(cond, []string{"idc", "mem"}); err != nil {
+		t.Errorf("ValidateCond = %v", err)
+	}
+	if err := apollo.ValidateCond(cond, []string{"idc"}); !errors.Is(err, apollo.ErrUnknownField) {
+		t.Errorf("ValidateCond = %v, want ErrUnknownField", err)
+	}
+}
+
+func TestQueryResByTypeAndCond(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+	srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"idc": "sh", "cpu": 8}), "dba")
+	srv.AddResource(apollotest.Res("host", "db02", apollo.Attr{"idc": "sh", "cpu": 4}), "dba")
+	srv.AddResource(apollotest.Res("host", "web01", apollo.Attr{"idc": "bj", "cpu": 16, "$zone": "a"}), "web")
+
+	names := func(cond apollo.Cond) []string {
+		t.Helper()
+		res, err := cli.QueryResByTypeAndCond(ctx, "host", cond)
+		if err != nil {
+			t.Fatalf("QueryResByTypeAndCond(%s): %v", cond, err)
+		}
+		var out []string
+		for _, r := range res {
+			out = append(out, r.Attrs["name"].(string))
+		}
+		return out
+	}
+
+	if got := names(apollo.And(apollo.Eq("idc", "sh"), apollo.Gt("cpu", 4))); len(got) != 1 || got[0] != "db01" {
+		t.Errorf("idc = sh AND cpu > 4: %v, want [db01]", got)
+	}
+	if got := names(apollo.Or(apollo.Lt("cpu", 8), apollo.Like("name", "web%"))); len(got) != 2 {
+		t.Errorf("cpu < 8 OR name LIKE web%%: %v, want db02 and web01", got)
+	}
+	if got := names(apollo.Not(apollo.Eq("idc", "sh"))); len(got) != 1 || got[0] != "web01" {
+		t.Errorf("NOT idc = sh: %v, want [web01]", got)
+	}
+
+	res, err := cli.QueryResByTypeAndCondition(ctx, "host", map[string]any{"$zone": "a", "idc": "bj"})
+	if err != nil || len(res) != 1 {
+		t.Errorf("QueryResByTypeAndCondition($zone) = %v, %v, want web01", res, err)
+	}
+}
+
+func TestQueryResByTypeAndConditionPayload(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+
+	cond := map[string]any{"$or": []any{map[string]any{"idc": "sh"}, map[string]any{"idc": "bj"}}, "cpu": 8}
+	_, _ = cli.QueryResByTypeAndCondition(ctx, "host", cond)
+	_, _ = cli.QueryResByTypeAndCondition(ctx, "host", nil)
+
+	calls := srv.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("%d calls, want 2", len(calls))
+	}
+	got, _ := json.Marshal(calls[0].Params["conditions"])
+	want, _ := json.Marshal(cond)
+	if string(got) != string(want) {
+		t.Errorf("conditions = %s, want the map unchanged %s", got, want)
+	}
+	if c, ok := calls[1].Params["conditions"]; !ok || c != nil {
+		t.Errorf("conditions of a nil map = %v, %v, want null", c, ok)
+	}
+}
@@ -1,18 +1,79 @@
 package apollo
 
-import "time"
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
 
 type Config struct {
 	Url   string
 	Token string
+	// TokenSource, when set, provides the token for each request instead of
+	// the static Token.
+	TokenSource TokenSource
 
 	Timeout time.Duration
 	Logger  Logger
+	Retry   RetryPolicy
+	// RateLimit throttles the requests, it is disabled by default. 429
+	// responses pause the requests for their Retry-After duration in any case.
+	RateLimit RateLimit
+	// Breaker fails calls fast while Apollo is unavailable, it is disabled by
+	// default.
+	Breaker BreakerPolicy
+
+	// Schemas lists the known attribute names per CI type. Query conditions
+	// on a type listed here are validated before the request is sent.
+	Schemas map[string][]string
+
+	// Lifecycle guards Client.TransitionState. DefaultLifecycle is used when nil.
+	Lifecycle *Lifecycle
+
+	// HTTPClient replaces the http.Client of the Client. It is copied, and
+	// Timeout is applied to the copy when it has none.
+	HTTPClient *http.Client
+	// Transport replaces the transport of the http.Client.
+	Transport http.RoundTripper
+	// TransportMiddlewares wrap the transport, the first one being the
+	// outermost, e.g. to add TLS client certificates, proxies or tracing.
+	TransportMiddlewares []TransportMiddleware
+	// Middlewares wrap every JSON-RPC call, see Client.Use.
+	Middlewares []Middleware
+
+	// Metrics, when set, observes every call.
+	Metrics Metrics
+	// Tracer, when set, traces the Iter pages and the batches, see Tracer.
+	Tracer Tracer
+	// Cache, when set, caches the results of query methods. It runs inside
+	// Middlewares.
+	Cache *Cache
+
+	// RedactKeys are the param names masked when payloads are logged at debug
+	// level, DefaultRedactKeys by default.
+	RedactKeys []string
+	// MaxLogBytes caps the size of the logged payloads. 0 means
+	// DefaultMaxLogBytes and a negative value disables the cap.
+	MaxLogBytes int
 }
 
 func DefaultConfig() Config {
 	return Config{
 		Timeout: 1 * time.Minute,
 		Logger:  DefaultLogger,
+		Retry:   DefaultRetryPolicy(),
+
+		RedactKeys:  DefaultRedactKeys,
+		MaxLogBytes: DefaultMaxLogBytes,
+	}
+}
+
+// Format keeps the token out of formatted output such as fmt.Printf("%v", c).
+func (c Config) Format(f fmt.State, verb rune) {
+	type config Config
+
+	if c.Token != "" {
+		c.Token = redacted
 	}
+	fmt.Fprintf(f, fmt.FormatString(f, verb), config(c))
 }
@@ -1,77 +1,311 @@
 package apollo
 
+import "slices"
+
+// State is the state of a resource.
+type State string
+
 const (
-	UnknownS         = ":UNKNOWN"
-	Online           = ":online"
-	Offline          = ":offline"
-	PreInstall       = ":pre_install"
-	PreInstallFailed = ":pre_install_failed"
-	Inventory        = ":inventory"
-	Test             = ":test"
-	OnJob            = ":onjob"
-	Resigned         = ":RESIGNED"
-	Resigning        = ":resigning"
+	UnknownS         State = ":UNKNOWN"
+	Online           State = ":online"
+	Offline          State = ":offline"
+	PreInstall       State = ":pre_install"
+	PreInstallFailed State = ":pre_install_failed"
+	Inventory        State = ":inventory"
+	Test             State = ":test"
+	OnJob            State = ":onjob"
+	Resigned         State = ":RESIGNED"
+	Resigning        State = ":resigning"
 )
 
+var stateValues = []State{UnknownS, Online, Offline, PreInstall, PreInstallFailed, Inventory, Test, OnJob, Resigned, Resigning}
+
+func StateValues() []State {
+	return slices.Clone(stateValues)
+}
+
+func ParseState(s string) (State, error) {
+	return parseEnum("State", s, stateValues)
+}
+
+func (s State) String() string {
+	return string(s)
+}
+
+func (s State) IsValid() bool {
+	return slices.Contains(stateValues, s)
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return marshalEnum("State", s, stateValues)
+}
+
+func (s *State) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("State", b, s, stateValues)
+}
+
+// RaidLevel is the raid level of a resource.
+type RaidLevel string
+
 const (
-	UnknownR = ":UNKNOWN"
-	Raid0    = ":RAID0"
-	Raid1    = ":RAID1"
-	Raid2    = ":RAID2"
-	Raid3    = ":RAID3"
-	Raid5    = ":RAID5"
-	Raid6    = ":RAID6"
-	Raid7    = ":RAID7"
-	Raid53   = ":RAID53"
-	Raid10   = ":RAID10"
+	UnknownR RaidLevel = ":UNKNOWN"
+	Raid0    RaidLevel = ":RAID0"
+	Raid1    RaidLevel = ":RAID1"
+	Raid2    RaidLevel = ":RAID2"
+	Raid3    RaidLevel = ":RAID3"
+	Raid5    RaidLevel = ":RAID5"
+	Raid6    RaidLevel = ":RAID6"
+	Raid7    RaidLevel = ":RAID7"
+	Raid53   RaidLevel = ":RAID53"
+	Raid10   RaidLevel = ":RAID10"
 )
 
+var raidLevelValues = []RaidLevel{UnknownR, Raid0, Raid1, Raid2, Raid3, Raid5, Raid6, Raid7, Raid53, Raid10}
+
+func RaidLevelValues() []RaidLevel {
+	return slices.Clone(raidLevelValues)
+}
+
+func ParseRaidLevel(s string) (RaidLevel, error) {
+	return parseEnum("RaidLevel", s, raidLevelValues)
+}
+
+func (r RaidLevel) String() string {
+	return string(r)
+}
+
+func (r RaidLevel) IsValid() bool {
+	return slices.Contains(raidLevelValues, r)
+}
+
+func (r RaidLevel) MarshalJSON() ([]byte, error) {
+	return marshalEnum("RaidLevel", r, raidLevelValues)
+}
+
+func (r *RaidLevel) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("RaidLevel", b, r, raidLevelValues)
+}
+
+// Priority is the priority of a resource.
+type Priority string
+
 const (
-	UnknownP = ":UNKNOWN"
-	P0       = ":P0"
-	P1       = ":P1"
-	P2       = ":P2"
-	P3       = ":P3"
-	P4       = ":P4"
+	UnknownP Priority = ":UNKNOWN"
+	P0       Priority = ":P0"
+	P1       Priority = ":P1"
+	P2       Priority = ":P2"
+	P3       Priority = ":P3"
+	P4       Priority = ":P4"
 )
 
+var priorityValues = []Priority{UnknownP, P0, P1, P2, P3, P4}
+
+func PriorityValues() []Priority {
+	return slices.Clone(priorityValues)
+}
+
+func ParsePriority(s string) (Priority, error) {
+	return parseEnum("Priority", s, priorityValues)
+}
+
+func (p Priority) String() string {
+	return string(p)
+}
+
+func (p Priority) IsValid() bool {
+	return slices.Contains(priorityValues, p)
+}
+
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return marshalEnum("Priority", p, priorityValues)
+}
+
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("Priority", b, p, priorityValues)
+}
+
+// IPVersion is the ip version of a resource.
+type IPVersion string
+
 const (
-	UnknownIP = ":UNKNOWN"
-	V4        = ":V4"
-	V6        = ":V6"
+	UnknownIP IPVersion = ":UNKNOWN"
+	V4        IPVersion = ":V4"
+	V6        IPVersion = ":V6"
 )
 
+var iPVersionValues = []IPVersion{UnknownIP, V4, V6}
+
+func IPVersionValues() []IPVersion {
+	return slices.Clone(iPVersionValues)
+}
+
+func ParseIPVersion(s string) (IPVersion, error) {
+	return parseEnum("IPVersion", s, iPVersionValues)
+}
+
+func (i IPVersion) String() string {
+	return string(i)
+}
+
+func (i IPVersion) IsValid() bool {
+	return slices.Contains(iPVersionValues, i)
+}
+
+func (i IPVersion) MarshalJSON() ([]byte, error) {
+	return marshalEnum("IPVersion", i, iPVersionValues)
+}
+
+func (i *IPVersion) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("IPVersion", b, i, iPVersionValues)
+}
+
+// DeviceKind is the device kind of a resource.
+type DeviceKind string
+
 const (
-	UnknownD = ":UNKNOWN"
-	Storage  = ":storage"
-	Memory   = ":memory"
-	Cpu      = ":cpu"
-	Network  = ":network"
+	UnknownD DeviceKind = ":UNKNOWN"
+	Storage  DeviceKind = ":storage"
+	Memory   DeviceKind = ":memory"
+	Cpu      DeviceKind = ":cpu"
+	Network  DeviceKind = ":network"
 )
 
+var deviceKindValues = []DeviceKind{UnknownD, Storage, Memory, Cpu, Network}
+
+func DeviceKindValues() []DeviceKind {
+	return slices.Clone(deviceKindValues)
+}
+
+func ParseDeviceKind(s string) (DeviceKind, error) {
+	return parseEnum("DeviceKind", s, deviceKindValues)
+}
+
+func (d DeviceKind) String() string {
+	return string(d)
+}
+
+func (d DeviceKind) IsValid() bool {
+	return slices.Contains(deviceKindValues, d)
+}
+
+func (d DeviceKind) MarshalJSON() ([]byte, error) {
+	return marshalEnum("DeviceKind", d, deviceKindValues)
+}
+
+func (d *DeviceKind) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("DeviceKind", b, d, deviceKindValues)
+}
+
+// DiskKind is the disk kind of a resource.
+type DiskKind string
+
 const (
-	UnknownDi = ":UNKNOWN"
-	Sas       = ":SAS"
-	Ssd       = ":SSD"
-	Sata      = ":SATA"
+	UnknownDi DiskKind = ":UNKNOWN"
+	Sas       DiskKind = ":SAS"
+	Ssd       DiskKind = ":SSD"
+	Sata      DiskKind = ":SATA"
 )
 
+var diskKindValues = []DiskKind{UnknownDi, Sas, Ssd, Sata}
+
+func DiskKindValues() []DiskKind {
+	return slices.Clone(diskKindValues)
+}
+
+func ParseDiskKind(s string) (DiskKind, error) {
+	return parseEnum("DiskKind", s, diskKindValues)
+}
+
+func (d DiskKind) String() string {
+	return string(d)
+}
+
+func (d DiskKind) IsValid() bool {
+	return slices.Contains(diskKindValues, d)
+}
+
+func (d DiskKind) MarshalJSON() ([]byte, error) {
+	return marshalEnum("DiskKind", d, diskKindValues)
+}
+
+func (d *DiskKind) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("DiskKind", b, d, diskKindValues)
+}
+
+// MachineKind is the machine kind of a resource.
+type MachineKind string
+
 const (
-	UnknownM = ":UNKNOWN"
-	Physical = ":physical"
-	Virtual  = ":virtual"
+	UnknownM MachineKind = ":UNKNOWN"
+	Physical MachineKind = ":physical"
+	Virtual  MachineKind = ":virtual"
 )
 
+var machineKindValues = []MachineKind{UnknownM, Physical, Virtual}
+
+func MachineKindValues() []MachineKind {
+	return slices.Clone(machineKindValues)
+}
+
+func ParseMachineKind(s string) (MachineKind, error) {
+	return parseEnum("MachineKind", s, machineKindValues)
+}
+
+func (m MachineKind) String() string {
+	return string(m)
+}
+
+func (m MachineKind) IsValid() bool {
+	return slices.Contains(machineKindValues, m)
+}
+
+func (m MachineKind) MarshalJSON() ([]byte, error) {
+	return marshalEnum("MachineKind", m, machineKindValues)
+}
+
+func (m *MachineKind) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("MachineKind", b, m, machineKindValues)
+}
+
+// Manufacturer is the manufacturer of a resource.
+type Manufacturer string
+
 const (
-	UnknownMan  = ":UNKNOWN"
-	Dell        = ":Dell"
-	HP          = ":HP"
-	HW          = ":HW"
-	Sugon       = ":SUGON"
-	PowerLeader = ":POWERLEADER"
-	Lenovo      = ":LENOVO"
-	H3C         = ":H3C"
-	ZTE         = ":ZTE"
-	Inspur      = ":INSPUR"
-	Huawei      = ":HUAWEI"
+	UnknownMan  Manufacturer = ":UNKNOWN"
+	Dell        Manufacturer = ":Dell"
+	HP          Manufacturer = ":HP"
+	HW          Manufacturer = ":HW"
+	Sugon       Manufacturer = ":SUGON"
+	PowerLeader Manufacturer = ":POWERLEADER"
+	Lenovo      Manufacturer = ":LENOVO"
+	H3C         Manufacturer = ":H3C"
+	ZTE         Manufacturer = ":ZTE"
+	Inspur      Manufacturer = ":INSPUR"
+	Huawei      Manufacturer = ":HUAWEI"
 )
+
+var manufacturerValues = []Manufacturer{UnknownMan, Dell, HP, HW, Sugon, PowerLeader, Lenovo, H3C, ZTE, Inspur, Huawei}
+
+func ManufacturerValues() []Manufacturer {
+	return slices.Clone(manufacturerValues)
+}
+
+func ParseManufacturer(s string) (Manufacturer, error) {
+	return parseEnum("Manufacturer", s, manufacturerValues)
+}
+
+func (m Manufacturer) String() string {
+	return string(m)
+}
+
+func (m Manufacturer) IsValid() bool {
+	return slices.Contains(manufacturerValues, m)
+}
+
+func (m Manufacturer) MarshalJSON() ([]byte, error) {
+	return marshalEnum("Manufacturer", m, manufacturerValues)
+}
+
+func (m *Manufacturer) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum("Manufacturer", b, m, manufacturerValues)
+}
@@ -0,0 +1,87 @@
+package apollo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+// respond makes the client get body for every request, with a 200 status.
+func respond(body string) func(*apollo.Config) {
+	return func(c *apollo.Config) {
+		c.Transport = apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    req,
+			}, nil
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	cli, _ := newTestClient(t, respond(`{"jsonrpc":"2.0","id":1,"result":{"id":"db01"}}`))
+
+	_, err := cli.QueryResById(context.Background(), 1)
+	var de *apollo.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("err = %v, want *DecodeError", err)
+	}
+	if de.Method != "query.resource" || de.Payload != `{"id":"db01"}` {
+		t.Errorf("DecodeError = %+v", de)
+	}
+	var ute *json.UnmarshalTypeError
+	if !errors.As(err, &ute) {
+		t.Errorf("err = %v, want it to wrap the *json.UnmarshalTypeError", err)
+	}
+	if !errors.Is(err, apollo.JsonMarshalFailed) {
+		t.Errorf("errors.Is(%v, JsonMarshalFailed) = false", err)
+	}
+}
+
+func TestDecodeErrorPayload(t *testing.T) {
+	long := `"` + strings.Repeat("x", 2048) + `"`
+	cli, _ := newTestClient(t, respond(`{"jsonrpc":"2.0","id":1,"result":`+long+`}`))
+
+	_, err := cli.ListTypes(context.Background())
+	var de *apollo.DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("err = %v, want *DecodeError", err)
+	}
+	if len(de.Payload) >= len(long) || !strings.HasPrefix(de.Payload, `"xxx`) {
+		t.Errorf("Payload has %d bytes, want a truncated one", len(de.Payload))
+	}
+}
+
+func TestDecodeNull(t *testing.T) {
+	cli, _ := newTestClient(t, respond(`{"jsonrpc":"2.0","id":1,"result":null}`))
+	ctx := context.Background()
+
+	agg, err := cli.QueryAggRes(ctx, "g", nil)
+	if err != nil || agg == nil {
+		t.Errorf("QueryAggRes = %v, %v, want a zero value", agg, err)
+	}
+	join, err := cli.QueryAggResLeftJoin(ctx, "g", "host", nil)
+	if err != nil || join == nil {
+		t.Errorf("QueryAggResLeftJoin = %v, %v, want a zero value", join, err)
+	}
+	group, err := cli.QueryResOpsGroupById(ctx, 1)
+	if err != nil || group == nil {
+		t.Errorf("QueryResOpsGroupById = %v, %v, want a zero value", group, err)
+	}
+	res, err := cli.QueryResById(ctx, 1)
+	if err != nil || res == nil || res.Rel == nil {
+		t.Errorf("QueryResById = %+v, %v, want an empty resource", res, err)
+	}
+	list, err := cli.QueryResByType(ctx, "host")
+	if err != nil || list == nil {
+		t.Errorf("QueryResByType = %v, %v, want an empty list", list, err)
+	}
+}
@@ -0,0 +1,76 @@
+package apollo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidEnum = errors.New("invalid enum value")
+
+// EnumError reports a value that is not part of an enum such as State.
+type EnumError struct {
+	Type  string
+	Value string
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("apollo: invalid %s %q", e.Type, e.Value)
+}
+
+func (e *EnumError) Unwrap() error {
+	return ErrInvalidEnum
+}
+
+// parseEnum matches s against values. The leading colon is optional and the
+// comparison is case-insensitive, so "online" and ":Online" both parse to
+// Online.
+func parseEnum[T ~string](name, s string, values []T) (T, error) {
+	v := strings.TrimSpace(s)
+	if !strings.HasPrefix(v, ":") {
+		v = ":" + v
+	}
+	for _, e := range values {
+		if strings.EqualFold(string(e), v) {
+			return e, nil
+		}
+	}
+	return "", &EnumError{Type: name, Value: s}
+}
+
+// marshalEnum writes the canonical spelling of v, "" for the zero value. Values
+// that aren't part of the enum are rejected, so that typos are caught before
+// they reach the server.
+func marshalEnum[T ~string](name string, v T, values []T) ([]byte, error) {
+	if v == "" {
+		return []byte(`""`), nil
+	}
+	e, err := parseEnum(name, string(v), values)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(e))
+}
+
+// unmarshalEnum normalizes the spelling of known values like parseEnum. Values
+// that aren't part of the enum, such as states added to Apollo after this
+// package, are kept as they are; check them with IsValid. They fail to marshal
+// back.
+func unmarshalEnum[T ~string](name string, b []byte, v *T, values []T) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil || *s == "" {
+		*v = ""
+		return nil
+	}
+
+	e, err := parseEnum(name, *s, values)
+	if err != nil {
+		e = T(*s)
+	}
+	*v = e
+	return nil
+}
@@ -0,0 +1,115 @@
+package apollo_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+func TestParseState(t *testing.T) {
+	for _, s := range []string{":online", "online", " :Online ", "ONLINE"} {
+		got, err := apollo.ParseState(s)
+		if err != nil || got != apollo.Online {
+			t.Errorf("ParseState(%q) = %q, %v, want %q", s, got, err, apollo.Online)
+		}
+	}
+
+	_, err := apollo.ParseState("maintenance")
+	var enumErr *apollo.EnumError
+	if !errors.As(err, &enumErr) || !errors.Is(err, apollo.ErrInvalidEnum) || enumErr.Type != "State" {
+		t.Errorf("ParseState(maintenance) = %v, want *EnumError", err)
+	}
+}
+
+func TestEnumRoundTrip(t *testing.T) {
+	type attrs struct {
+		State apollo.State     `json:"state"`
+		Raid  apollo.RaidLevel `json:"raid"`
+	}
+
+	tests := []struct {
+		in   string
+		want attrs
+		out  string
+	}{
+		{`{"state":":online","raid":":RAID10"}`, attrs{apollo.Online, apollo.Raid10}, `{"state":":online","raid":":RAID10"}`},
+		{`{"state":"Online","raid":"raid10"}`, attrs{apollo.Online, apollo.Raid10}, `{"state":":online","raid":":RAID10"}`},
+		{`{"state":"","raid":null}`, attrs{}, `{"state":"","raid":""}`},
+		// unknown values are kept, but don't marshal back.
+		{`{"state":":maintenance","raid":":RAID60"}`, attrs{":maintenance", ":RAID60"}, ""},
+	}
+	for _, tt := range tests {
+		var got attrs
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		out, err := json.Marshal(got)
+		if tt.out == "" {
+			if !errors.Is(err, apollo.ErrInvalidEnum) {
+				t.Errorf("Marshal(%+v) = %s, %v, want ErrInvalidEnum", got, out, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Marshal(%+v): %v", got, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("Marshal(%+v) = %s, want %s", got, out, tt.out)
+		}
+	}
+
+	if apollo.State(":maintenance").IsValid() || !apollo.Online.IsValid() {
+		t.Error("IsValid doesn't match the known states")
+	}
+}
+
+func TestAttrBaseState(t *testing.T) {
+	out, err := json.Marshal(apollo.AttrBase{Name: "db01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	_ = json.Unmarshal(out, &m)
+	if v, ok := m["state"]; !ok || v != "" {
+		t.Errorf("Marshal(AttrBase) = %s, want an empty state", out)
+	}
+}
+
+func TestEnumMarshal(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{apollo.State(":Online"), `":online"`},
+		{apollo.RaidLevel("raid10"), `":RAID10"`},
+		{apollo.Priority(""), `""`},
+		{apollo.IPVersion(""), `""`},
+		{apollo.DeviceKind(""), `""`},
+		{apollo.DiskKind(""), `""`},
+		{apollo.MachineKind(""), `""`},
+		{apollo.Manufacturer(""), `""`},
+	}
+	for _, tt := range tests {
+		if out, err := json.Marshal(tt.in); err != nil || string(out) != tt.want {
+			t.Errorf("Marshal(%#v) = %s, %v, want %s", tt.in, out, err, tt.want)
+		}
+	}
+
+	for _, v := range []any{
+		apollo.State("maintenance"), apollo.RaidLevel("x"), apollo.Priority("x"), apollo.IPVersion("x"),
+		apollo.DeviceKind("x"), apollo.DiskKind("x"), apollo.MachineKind("x"), apollo.Manufacturer("x"),
+	} {
+		_, err := json.Marshal(v)
+		var enumErr *apollo.EnumError
+		if !errors.As(err, &enumErr) || enumErr.Value == "" {
+			t.Errorf("Marshal(%#v) = %v, want *EnumError", v, err)
+		}
+	}
+}
@@ -1,8 +1,155 @@
 package apollo
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 var (
+	// JsonMarshalFailed is matched by *DecodeError.
 	JsonMarshalFailed = errors.New("json marshal is failed")
-	BadGateway        = errors.New("bad gateway")
+	// BadGateway is matched by the *HTTPError of 502 responses.
+	BadGateway = errors.New("bad gateway")
+)
+
+// Sentinel errors matched by *RPCError through errors.Is.
+var (
+	ErrParse          = errors.New("parse error")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrMethodNotFound = errors.New("method not found")
+	ErrInvalidParams  = errors.New("invalid params")
+	ErrInternal       = errors.New("internal error")
+)
+
+// Sentinel errors matched by *HTTPError through errors.Is, and returned by the
+// Client when a resource doesn't exist.
+var (
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
 )
+
+// JSON-RPC 2.0 error codes, as defined by the specification. Apollo doesn't
+// document the codes it uses in the -32000 to -32099 server error range, so
+// they are left to RPCError.Code.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var codeErrors = map[int]error{
+	CodeParseError:     ErrParse,
+	CodeInvalidRequest: ErrInvalidRequest,
+	CodeMethodNotFound: ErrMethodNotFound,
+	CodeInvalidParams:  ErrInvalidParams,
+	CodeInternalError:  ErrInternal,
+}
+
+// RPCError is the JSON-RPC 2.0 error object returned by the Apollo server.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	if e.Data != nil {
+		return fmt.Sprintf("apollo rpc error %d: %s (%v)", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("apollo rpc error %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether the error code maps to target, so that callers can use
+// errors.Is(err, ErrInvalidParams) and friends.
+func (e *RPCError) Is(target error) bool {
+	sentinel, ok := codeErrors[e.Code]
+	return ok && sentinel == target
+}
+
+// DecodeError is returned when a response or its result can't be decoded.
+// It matches JsonMarshalFailed through errors.Is.
+type DecodeError struct {
+	Method string
+	// Payload is the beginning of the data that couldn't be decoded, empty
+	// for streamed responses.
+	Payload string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("apollo: can't decode %s response: %v", e.Method, e.Err)
+	if e.Payload != "" {
+		msg += ": " + e.Payload
+	}
+	return msg
+}
+
+func (e *DecodeError) Unwrap() []error {
+	return []error{e.Err, JsonMarshalFailed}
+}
+
+// maxErrorBody caps the response body kept in an HTTPError or a DecodeError.
+const maxErrorBody = 512
+
+// HTTPError is returned for non-2xx responses. It matches BadGateway,
+// ErrUnauthorized, ErrPermissionDenied and ErrNotFound through errors.Is for
+// the 502, 401, 403 and 404 statuses.
+type HTTPError struct {
+	StatusCode int
+	// Body is the beginning of the response body.
+	Body string
+	// Method is the JSON-RPC method, "rpc.batch" for batches.
+	Method string
+	// RequestID is the JSON-RPC id of the request, the first one for batches.
+	RequestID int64
+	// RetryAfter is the Retry-After header of 429 and 503 responses.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("apollo http status %d for %s (id %d)", e.StatusCode, e.Method, e.RequestID)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+var statusErrors = map[int]error{
+	http.StatusBadGateway:   BadGateway,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrPermissionDenied,
+	http.StatusNotFound:     ErrNotFound,
+}
+
+func (e *HTTPError) Is(target error) bool {
+	sentinel, ok := statusErrors[e.StatusCode]
+	return ok && sentinel == target
+}
+
+// IsUnauthorized reports whether err is an authentication failure, from the
+// HTTP status. The token is likely expired.
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// IsPermissionDenied reports whether the token lacks the rights for the call.
+func IsPermissionDenied(err error) bool {
+	return errors.Is(err, ErrPermissionDenied)
+}
+
+// IsNotFound reports whether err is a missing resource or endpoint.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsRetryable reports whether err is a transient failure that may succeed if
+// the call is retried later: a 429, 502, 503 or 504 status, a timeout or a
+// reset connection.
+func IsRetryable(err error) bool {
+	return DefaultRetryPolicy().retryable(err)
+}
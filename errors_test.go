@@ -0,0 +1,148 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestRPCError(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+
+	srv.FailNext("query.resource", apollo.CodeInvalidParams, "bad id")
+	_, err := cli.QueryResById(ctx, 1)
+
+	var rpcErr *apollo.RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("err = %v, want *RPCError", err)
+	}
+	if rpcErr.Code != apollo.CodeInvalidParams || rpcErr.Message != "bad id" {
+		t.Errorf("RPCError = %+v", rpcErr)
+	}
+	if !errors.Is(err, apollo.ErrInvalidParams) {
+		t.Errorf("errors.Is(%v, ErrInvalidParams) = false", err)
+	}
+	if errors.Is(err, apollo.ErrInternal) {
+		t.Errorf("errors.Is(%v, ErrInternal) = true", err)
+	}
+}
+
+func TestRPCErrorServerCode(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+
+	srv.FailNext("query.resource", -32004, "gone")
+	_, err := cli.QueryResById(context.Background(), 1)
+
+	var rpcErr *apollo.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32004 {
+		t.Fatalf("err = %v, want *RPCError with code -32004", err)
+	}
+	for _, sentinel := range []error{apollo.ErrNotFound, apollo.ErrUnauthorized, apollo.ErrInternal} {
+		if errors.Is(err, sentinel) {
+			t.Errorf("errors.Is(%v, %v) = true for an undocumented code", err, sentinel)
+		}
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Token = "wrong"
+	})
+
+	_, err := cli.QueryResById(context.Background(), 1)
+	if !apollo.IsUnauthorized(err) {
+		t.Fatalf("IsUnauthorized(%v) = false", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	tests := []struct {
+		status    int
+		sentinel  error
+		retryable bool
+	}{
+		{http.StatusUnauthorized, apollo.ErrUnauthorized, false},
+		{http.StatusForbidden, apollo.ErrPermissionDenied, false},
+		{http.StatusNotFound, apollo.ErrNotFound, false},
+		{http.StatusTooManyRequests, nil, true},
+		{http.StatusInternalServerError, nil, false},
+		{http.StatusBadGateway, apollo.BadGateway, true},
+		{http.StatusServiceUnavailable, nil, true},
+		{http.StatusGatewayTimeout, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			cli, srv := newTestClient(t, nil)
+			srv.Inject(apollotest.Fault{Method: "query.resource", Status: tt.status})
+
+			_, err := cli.QueryResById(context.Background(), 1)
+			var he *apollo.HTTPError
+			if !errors.As(err, &he) {
+				t.Fatalf("err = %v, want *HTTPError", err)
+			}
+			if he.StatusCode != tt.status || he.Method != "query.resource" || he.RequestID == 0 {
+				t.Errorf("HTTPError = %+v", he)
+			}
+			if errors.Is(err, apollo.JsonMarshalFailed) {
+				t.Errorf("errors.Is(%v, JsonMarshalFailed) = true", err)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.sentinel)
+			}
+			if got := apollo.IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable(%v) = %v, want %v", err, got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorBody(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Transport = apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    req,
+			}, nil
+		})
+	})
+
+	_, err := cli.QueryResById(context.Background(), 1)
+	var he *apollo.HTTPError
+	if !errors.As(err, &he) {
+		t.Fatalf("err = %v, want *HTTPError", err)
+	}
+	if len(he.Body) >= len(body) || !strings.HasPrefix(he.Body, "xxx") {
+		t.Errorf("Body has %d bytes, want a bounded snippet", len(he.Body))
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&apollo.RPCError{Code: apollo.CodeInternalError}, false},
+		{&apollo.HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&apollo.HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{context.Canceled, false},
+		{syscall.ECONNRESET, true},
+		{io.ErrUnexpectedEOF, true},
+	}
+	for _, tt := range tests {
+		if got := apollo.IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
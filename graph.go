@@ -0,0 +1,512 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Direction selects the relations followed from a resource: its own
+// relations (Outgoing), the resources whose relations reference it
+// (Incoming), or both.
+type Direction int
+
+const (
+	Outgoing Direction = iota
+	Incoming
+	Both
+)
+
+// Order is the visiting order of Graph.Walk. It doesn't apply to Traverse,
+// which always fetches breadth first.
+type Order int
+
+const (
+	BFS Order = iota
+	DFS
+)
+
+// Defaults of TraverseOptions.
+const (
+	DefaultTraverseDepth       = 3
+	DefaultTraverseBatchSize   = 50
+	DefaultTraverseConcurrency = 4
+)
+
+// TraverseOptions configures Client.Traverse.
+type TraverseOptions struct {
+	// Relations are the relationship names followed, all of them when empty.
+	Relations []string
+	Direction Direction
+	// MaxDepth bounds the number of hops from the root, DefaultTraverseDepth
+	// by default. Relations fan out quickly, so large depths may fetch a
+	// large part of the CMDB.
+	MaxDepth int
+
+	// BatchSize is the number of lookups per batch request,
+	// DefaultTraverseBatchSize by default.
+	BatchSize int
+	// Concurrency bounds the batches in flight, DefaultTraverseConcurrency by
+	// default.
+	Concurrency int
+}
+
+// Edge is a relation named Rel of the resource From to the resource To.
+type Edge struct {
+	From int64
+	To   int64
+	Rel  string
+}
+
+// Graph is the part of the CMDB reached by Client.Traverse. Each resource is
+// held once, however many paths lead to it.
+type Graph struct {
+	Root int64
+
+	nodes map[int64]*Resource
+	depth map[int64]int
+	// order lists the ids in the order they were reached, breadth first.
+	order []int64
+	out   map[int64][]Edge
+	in    map[int64][]Edge
+	edges map[Edge]struct{}
+}
+
+func newGraph(root int64) *Graph {
+	return &Graph{
+		Root:  root,
+		nodes: make(map[int64]*Resource),
+		depth: make(map[int64]int),
+		out:   make(map[int64][]Edge),
+		in:    make(map[int64][]Edge),
+		edges: make(map[Edge]struct{}),
+	}
+}
+
+// Traverse fetches the resources reached from the resource root by following
+// opts.Relations in opts.Direction. The fetching is always breadth first,
+// level by level, each level with batch requests; Graph.Walk visits the
+// fetched graph in depth-first order if needed. The relations of the
+// resources at opts.MaxDepth aren't followed, and relations to resources
+// that no longer exist are dropped.
+//
+//	// the services depending, up to 5 hops away, on the switch
+//	g, err := cli.Traverse(ctx, switchID, apollo.TraverseOptions{
+//		Relations: []string{"uplink", "runs_on"},
+//		Direction: apollo.Incoming,
+//		MaxDepth:  5,
+//	})
+func (c *Client) Traverse(ctx context.Context, root int64, opts TraverseOptions) (*Graph, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultTraverseDepth
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultTraverseBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultTraverseConcurrency
+	}
+
+	g := newGraph(root)
+	res, err := c.fetchNodes(ctx, []int64{root}, opts)
+	if err != nil {
+		c.log.Error(err, "fail to traverse resources", "root", root)
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("%w: resource %d", ErrNotFound, root)
+	}
+	g.add(res[0], 0)
+
+	frontier := []int64{root}
+	for depth := 0; len(frontier) > 0 && depth < opts.MaxDepth; depth++ {
+		var next []int64
+		if opts.Direction != Incoming {
+			var (
+				ids     []int64
+				pending = make(map[int64]bool)
+			)
+			for _, id := range frontier {
+				for _, e := range relEdges(g.nodes[id], opts.Relations) {
+					if _, ok := g.nodes[e.To]; !ok && !pending[e.To] {
+						pending[e.To] = true
+						ids = append(ids, e.To)
+					}
+				}
+			}
+
+			res, err := c.fetchNodes(ctx, ids, opts)
+			if err != nil {
+				c.log.Error(err, "fail to traverse resources", "root", root, "depth", depth+1)
+				return nil, err
+			}
+			for _, r := range res {
+				g.add(r, depth+1)
+				next = append(next, r.ID)
+			}
+		}
+
+		if opts.Direction != Outgoing {
+			refs, err := c.fetchReferrers(ctx, frontier, opts)
+			if err != nil {
+				c.log.Error(err, "fail to traverse resources", "root", root, "depth", depth+1)
+				return nil, err
+			}
+			for i, id := range frontier {
+				for _, r := range refs[i] {
+					if _, ok := g.nodes[r.ID]; ok || !refers(r, id, opts.Relations) {
+						continue
+					}
+					g.add(r, depth+1)
+					next = append(next, r.ID)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	for _, id := range g.order {
+		for _, e := range relEdges(g.nodes[id], opts.Relations) {
+			g.link(e)
+		}
+	}
+	return g, nil
+}
+
+// fetchNodes looks the resources ids up, skipping the missing ones.
+func (c *Client) fetchNodes(ctx context.Context, ids []int64, opts TraverseOptions) ([]*Resource, error) {
+	calls, err := c.runBatches(ctx, len(ids), opts, func(b *Batch, i int) *BatchCall {
+		return b.QueryResById(ids[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Resource, 0, len(ids))
+	for _, bc := range calls {
+		r, err := bc.Resource()
+		if errors.Is(err, ErrNotFound) || (err == nil && r.ID == 0) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// fetchReferrers finds the resources referencing each of ids.
+func (c *Client) fetchReferrers(ctx context.Context, ids []int64, opts TraverseOptions) ([][]*Resource, error) {
+	calls, err := c.runBatches(ctx, len(ids), opts, func(b *Batch, i int) *BatchCall {
+		return b.Find(NewQuery().ReferencedBy(ids[i]))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([][]*Resource, len(calls))
+	for i, bc := range calls {
+		if refs[i], err = bc.Resources(); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// runBatches sends n calls built by add, opts.BatchSize per batch with at
+// most opts.Concurrency batches in flight. The calls are returned in order.
+// The first failed batch cancels the others, and no batch is started after
+// it.
+func (c *Client) runBatches(ctx context.Context, n int, opts TraverseOptions, add func(b *Batch, i int) *BatchCall) ([]*BatchCall, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		calls    = make([]*BatchCall, n)
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, opts.Concurrency)
+	)
+send:
+	for start := 0; start < n; start += opts.BatchSize {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// a failed batch cancels ctx before releasing its slot.
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			break send
+		}
+
+		b := c.NewBatch()
+		for i := start; i < min(start+opts.BatchSize, n); i++ {
+			calls[i] = add(b, i)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := b.Send(ctx); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return calls, nil
+}
+
+func (g *Graph) add(r *Resource, depth int) {
+	g.nodes[r.ID] = r
+	g.depth[r.ID] = depth
+	g.order = append(g.order, r.ID)
+}
+
+func (g *Graph) link(e Edge) {
+	if _, ok := g.nodes[e.From]; !ok {
+		return
+	}
+	if _, ok := g.nodes[e.To]; !ok {
+		return
+	}
+	if _, ok := g.edges[e]; ok {
+		return
+	}
+	g.edges[e] = struct{}{}
+	g.out[e.From] = append(g.out[e.From], e)
+	g.in[e.To] = append(g.in[e.To], e)
+}
+
+// relEdges returns the edges of the relations of r named in names, all of
+// them when names is empty, sorted by name.
+func relEdges(r *Resource, names []string) []Edge {
+	var edges []Edge
+	for _, rel := range slices.Sorted(maps.Keys(r.Rel)) {
+		if len(names) > 0 && !slices.Contains(names, rel) {
+			continue
+		}
+		for _, to := range r.Rel[rel] {
+			if to.ID != 0 {
+				edges = append(edges, Edge{From: r.ID, To: to.ID, Rel: rel})
+			}
+		}
+	}
+	return edges
+}
+
+// refers reports whether a relation of r named in names references id.
+func refers(r *Resource, id int64, names []string) bool {
+	return slices.ContainsFunc(relEdges(r, names), func(e Edge) bool { return e.To == id })
+}
+
+// Len returns the number of resources of g.
+func (g *Graph) Len() int {
+	return len(g.nodes)
+}
+
+// Node returns the resource id.
+func (g *Graph) Node(id int64) (*Resource, bool) {
+	r, ok := g.nodes[id]
+	return r, ok
+}
+
+// Nodes returns the resources in the order they were reached, the root first.
+func (g *Graph) Nodes() []*Resource {
+	res := make([]*Resource, 0, len(g.order))
+	for _, id := range g.order {
+		res = append(res, g.nodes[id])
+	}
+	return res
+}
+
+// Depth returns the number of hops from the root to the resource id, on the
+// shortest path found by Traverse.
+func (g *Graph) Depth(id int64) (int, bool) {
+	d, ok := g.depth[id]
+	return d, ok
+}
+
+// Edges returns the relations between the resources of g.
+func (g *Graph) Edges() []Edge {
+	var edges []Edge
+	for _, id := range g.order {
+		edges = append(edges, g.out[id]...)
+	}
+	return edges
+}
+
+// Neighbors returns the resources related to id in direction dir.
+func (g *Graph) Neighbors(id int64, dir Direction) []*Resource {
+	var res []*Resource
+	for _, n := range g.neighbors(id, dir) {
+		if !slices.Contains(res, g.nodes[n]) {
+			res = append(res, g.nodes[n])
+		}
+	}
+	return res
+}
+
+func (g *Graph) neighbors(id int64, dir Direction) []int64 {
+	var ids []int64
+	if dir != Incoming {
+		for _, e := range g.out[id] {
+			ids = append(ids, e.To)
+		}
+	}
+	if dir != Outgoing {
+		for _, e := range g.in[id] {
+			ids = append(ids, e.From)
+		}
+	}
+	return ids
+}
+
+// Path returns a shortest path from the resource from to the resource to,
+// following the relations in direction dir, both ends included. It returns
+// false if to can't be reached.
+func (g *Graph) Path(from, to int64, dir Direction) ([]*Resource, bool) {
+	if _, ok := g.nodes[from]; !ok {
+		return nil, false
+	}
+
+	prev := map[int64]int64{from: from}
+	queue := []int64{from}
+	for len(queue) > 0 && queue[0] != to {
+		id := queue[0]
+		queue = queue[1:]
+		for _, n := range g.neighbors(id, dir) {
+			if _, ok := prev[n]; !ok {
+				prev[n] = id
+				queue = append(queue, n)
+			}
+		}
+	}
+	if _, ok := prev[to]; !ok {
+		return nil, false
+	}
+
+	var path []*Resource
+	for id := to; ; id = prev[id] {
+		path = append(path, g.nodes[id])
+		if id == from {
+			break
+		}
+	}
+	slices.Reverse(path)
+	return path, true
+}
+
+// Walk visits the resources reachable from the resource from in direction
+// dir, each one once, and stops when fn returns false. With BFS, depth is the
+// distance from from; with DFS, it is the depth in the depth-first tree,
+// which may be longer than the shortest path.
+func (g *Graph) Walk(from int64, dir Direction, order Order, fn func(r *Resource, depth int) bool) {
+	if _, ok := g.nodes[from]; !ok {
+		return
+	}
+
+	type item struct {
+		id    int64
+		depth int
+	}
+	var (
+		seen    = map[int64]bool{}
+		pending = []item{{from, 0}}
+	)
+	for len(pending) > 0 {
+		var it item
+		if order == DFS {
+			it, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		} else {
+			it, pending = pending[0], pending[1:]
+		}
+		if seen[it.id] {
+			continue
+		}
+		seen[it.id] = true
+		if !fn(g.nodes[it.id], it.depth) {
+			return
+		}
+
+		ns := g.neighbors(it.id, dir)
+		if order == DFS {
+			// push in reverse so that the first neighbor is visited first.
+			slices.Reverse(ns)
+		}
+		for _, n := range ns {
+			if !seen[n] {
+				pending = append(pending, item{n, it.depth + 1})
+			}
+		}
+	}
+}
+
+// Cycle returns a cycle of relations of g, such as a service depending on
+// itself through other resources, the first resource being repeated at the
+// end. It returns false if the relations form no cycle.
+func (g *Graph) Cycle() ([]*Resource, bool) {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	var (
+		state = make(map[int64]int, len(g.nodes))
+		stack []int64
+		cycle []int64
+	)
+
+	var visit func(id int64) bool
+	visit = func(id int64) bool {
+		state[id] = active
+		stack = append(stack, id)
+		for _, e := range g.out[id] {
+			switch state[e.To] {
+			case active:
+				start := slices.Index(stack, e.To)
+				cycle = append(slices.Clone(stack[start:]), e.To)
+				return true
+			case unvisited:
+				if visit(e.To) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return false
+	}
+
+	for _, id := range g.order {
+		if state[id] == unvisited && visit(id) {
+			res := make([]*Resource, 0, len(cycle))
+			for _, id := range cycle {
+				res = append(res, g.nodes[id])
+			}
+			return res, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,220 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+// chain stores svc -runs_on-> vm -runs_on-> host -uplink-> tor -uplink-> core
+// and returns their ids in that order.
+func chain(srv *apollotest.Server) []int64 {
+	var ids []int64
+	for _, r := range []struct{ rType, name string }{
+		{"service", "api"}, {"vm", "vm01"}, {"host", "db01"}, {"switch", "tor01"}, {"switch", "core01"},
+	} {
+		ids = append(ids, srv.AddResource(apollotest.Res(r.rType, r.name, nil), "dba").ID)
+	}
+	srv.Relate(ids[0], "runs_on", ids[1])
+	srv.Relate(ids[1], "runs_on", ids[2])
+	srv.Relate(ids[2], "uplink", ids[3])
+	srv.Relate(ids[3], "uplink", ids[4])
+	return ids
+}
+
+func nodeIDs(res []*apollo.Resource) []int64 {
+	ids := make([]int64, 0, len(res))
+	for _, r := range res {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestTraverseOutgoing(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ids := chain(srv)
+	var cmdb apollo.CMDB = cli
+
+	// MaxDepth defaults to DefaultTraverseDepth hops.
+	g, err := cmdb.Traverse(context.Background(), ids[0], apollo.TraverseOptions{})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	if got := nodeIDs(g.Nodes()); !slices.Equal(got, ids[:4]) {
+		t.Errorf("nodes = %v, want %v", got, ids[:4])
+	}
+	for i, id := range ids[:4] {
+		if d, ok := g.Depth(id); !ok || d != i {
+			t.Errorf("Depth(%d) = %d, %v, want %d", id, d, ok, i)
+		}
+	}
+	if n := len(g.Edges()); n != 3 {
+		t.Errorf("%d edges, want 3", n)
+	}
+	path, ok := g.Path(ids[0], ids[3], apollo.Outgoing)
+	if !ok || !slices.Equal(nodeIDs(path), ids[:4]) {
+		t.Errorf("Path = %v, %v", nodeIDs(path), ok)
+	}
+	if _, ok = g.Path(ids[3], ids[0], apollo.Outgoing); ok {
+		t.Error("Path found against the relations")
+	}
+
+	g, err = cli.Traverse(context.Background(), ids[0], apollo.TraverseOptions{MaxDepth: 10})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	if g.Len() != len(ids) {
+		t.Errorf("%d nodes with MaxDepth 10, want %d", g.Len(), len(ids))
+	}
+}
+
+func TestTraverseIncoming(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ids := chain(srv)
+
+	g, err := cli.Traverse(context.Background(), ids[4], apollo.TraverseOptions{
+		Relations: []string{"uplink"},
+		Direction: apollo.Incoming,
+		MaxDepth:  10,
+	})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	// the runs_on relations aren't followed.
+	if want := []int64{ids[4], ids[3], ids[2]}; !slices.Equal(nodeIDs(g.Nodes()), want) {
+		t.Errorf("nodes = %v, want %v", nodeIDs(g.Nodes()), want)
+	}
+	if ns := g.Neighbors(ids[3], apollo.Both); len(ns) != 2 {
+		t.Errorf("tor01 has %d neighbors, want 2", len(ns))
+	}
+}
+
+func TestTraverseMissing(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	srv.Relate(host.ID, "uplink", 999)
+
+	g, err := cli.Traverse(context.Background(), host.ID, apollo.TraverseOptions{})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	if g.Len() != 1 || len(g.Edges()) != 0 {
+		t.Errorf("graph has %d nodes and %d edges, want the root only", g.Len(), len(g.Edges()))
+	}
+
+	if _, err = cli.Traverse(context.Background(), 999, apollo.TraverseOptions{}); !errors.Is(err, apollo.ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGraphWalkAndCycle(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	var ids []int64
+	for _, name := range []string{"a", "b", "c"} {
+		ids = append(ids, srv.AddResource(apollotest.Res("svc", name, nil), "dba").ID)
+	}
+	a, b, c := ids[0], ids[1], ids[2]
+	srv.Relate(a, "dep", b)
+	srv.Relate(a, "dep", c)
+	srv.Relate(b, "dep", c)
+
+	g, err := cli.Traverse(context.Background(), a, apollo.TraverseOptions{})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	if _, ok := g.Cycle(); ok {
+		t.Error("Cycle found in a DAG")
+	}
+
+	walk := func(order apollo.Order) map[int64]int {
+		depths := map[int64]int{}
+		g.Walk(a, apollo.Outgoing, order, func(r *apollo.Resource, depth int) bool {
+			depths[r.ID] = depth
+			return true
+		})
+		return depths
+	}
+	// c is one hop away, but two hops deep in the depth-first tree a, b, c.
+	if d := walk(apollo.BFS); d[c] != 1 {
+		t.Errorf("BFS depth of c = %d, want 1", d[c])
+	}
+	if d := walk(apollo.DFS); d[b] != 1 || d[c] != 2 {
+		t.Errorf("DFS depths = %v, want b 1 and c 2", d)
+	}
+
+	n := 0
+	g.Walk(a, apollo.Outgoing, apollo.BFS, func(*apollo.Resource, int) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Walk visited %d resources after fn returned false", n)
+	}
+
+	srv.Relate(c, "dep", a)
+	g, err = cli.Traverse(context.Background(), a, apollo.TraverseOptions{})
+	if err != nil {
+		t.Fatalf("Traverse: %v", err)
+	}
+	cycle, ok := g.Cycle()
+	if got := nodeIDs(cycle); !ok || len(got) < 3 || got[0] != got[len(got)-1] {
+		t.Errorf("Cycle = %v, %v", got, ok)
+	}
+}
+
+func TestTraverseStopsOnError(t *testing.T) {
+	var (
+		requests atomic.Int32
+		canceled atomic.Int32
+	)
+	// The root lookup succeeds, the next batch fails and the others hang
+	// until they are canceled.
+	fail := func(next http.RoundTripper) http.RoundTripper {
+		return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			switch requests.Add(1) {
+			case 1:
+				return next.RoundTrip(req)
+			case 2:
+				return nil, errors.New("connection refused")
+			}
+			select {
+			case <-req.Context().Done():
+				canceled.Add(1)
+				return nil, req.Context().Err()
+			case <-time.After(5 * time.Second):
+				return next.RoundTrip(req)
+			}
+		})
+	}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{fail}
+	})
+	root := srv.AddResource(apollotest.Res("switch", "tor01", nil), "dba")
+	for _, name := range []string{"db01", "db02", "db03", "db04", "db05", "db06"} {
+		host := srv.AddResource(apollotest.Res("host", name, nil), "dba")
+		srv.Relate(root.ID, "downlink", host.ID)
+	}
+
+	start := time.Now()
+	_, err := cli.Traverse(context.Background(), root.ID, apollo.TraverseOptions{BatchSize: 1, Concurrency: 2})
+	if err == nil {
+		t.Fatal("Traverse succeeded")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Traverse took %v, the batches in flight weren't canceled", d)
+	}
+	// the root and at most the 2 batches in flight.
+	if n := requests.Load(); n > 3 {
+		t.Errorf("%d requests sent, want no batch started after the failure", n)
+	}
+	if n := requests.Load(); n == 3 && canceled.Load() != 1 {
+		t.Error("the batch in flight wasn't canceled")
+	}
+}
@@ -0,0 +1,41 @@
+package apollo_test
+
+import (
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+const testToken = "secret-token"
+
+// newTestClient starts a fake server and a client of it, both closed when t
+// ends. setup may adjust the client config.
+func newTestClient(t *testing.T, setup func(*apollo.Config)) (*apollo.Client, *apollotest.Server) {
+	t.Helper()
+
+	srv := apollotest.NewServer(testToken)
+	t.Cleanup(srv.Close)
+
+	cfg := srv.Config()
+	if setup != nil {
+		setup(&cfg)
+	}
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(cli.Close)
+	return cli, srv
+}
+
+// calls counts the requests of method received by srv.
+func calls(srv *apollotest.Server, method string) int {
+	n := 0
+	for _, c := range srv.Calls() {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,75 @@
+package apollo
+
+import (
+	"context"
+	"iter"
+)
+
+// Querier is the read side of the CMDB.
+type Querier interface {
+	QueryResById(ctx context.Context, id int64) (*Resource, error)
+	QueryResByTypeAndName(ctx context.Context, rType, name string) (*Resource, error)
+	QueryResByType(ctx context.Context, rType string) ([]*Resource, error)
+	QueryResByGraphAndTarget(ctx context.Context, graph, target string) ([]*Resource, error)
+	QueryResByName(ctx context.Context, name string) ([]*Resource, error)
+	QueryResByGroupAndType(ctx context.Context, rType, group string) ([]*Resource, error)
+	QueryResByTypeAndCondition(ctx context.Context, rType string, cond map[string]any) ([]*Resource, error)
+	QueryResByTypeAndCond(ctx context.Context, rType string, cond Cond) ([]*Resource, error)
+	QueryResByTypeAndRelationship(ctx context.Context, pType, relationship, sType string) ([]*Resource, error)
+	QueryResByReferId(ctx context.Context, id int64) ([]*Resource, error)
+	Find(ctx context.Context, q *Query) ([]*Resource, error)
+	Iter(ctx context.Context, q *Query) iter.Seq2[*Resource, error]
+	IterResByType(ctx context.Context, rType string) iter.Seq2[*Resource, error]
+	IterResByGroupAndType(ctx context.Context, rType, group string) iter.Seq2[*Resource, error]
+	ListTypes(ctx context.Context) ([]string, error)
+	QueryAggRes(ctx context.Context, graph string, fields [][]string) (*AggRes, error)
+	QueryAggResWithGroup(ctx context.Context, graph, group string, fields [][]string) (*AggRes, error)
+	QueryAggResLeftJoin(ctx context.Context, graph, root string, fields []string) (*AggResLeftJoin, error)
+}
+
+// Mutator is the write side of the CMDB.
+type Mutator interface {
+	CreateRes(ctx context.Context, res Resource, group string) (*Resource, error)
+	CreateResLst(ctx context.Context, resLst []Resource, group string) (bool, error)
+	UpdateRes(ctx context.Context, res Resource) (bool, error)
+	UpdateResLst(ctx context.Context, resLst []Resource) (bool, error)
+	UpdateResById(ctx context.Context, id int64, attr Attr) (bool, error)
+	UpdateResByTypeAndName(ctx context.Context, rtype, name string, attr Attr) (bool, error)
+	UpdateResRel(ctx context.Context, id int64, rels Rel, mode string) (bool, error)
+	TransitionState(ctx context.Context, id int64, to State) error
+	DeleteById(ctx context.Context, id int64) (bool, error)
+	DeleteByTypeAndName(ctx context.Context, rtype, name string) (bool, error)
+}
+
+// GroupService covers ops groups and the ownership of resources.
+type GroupService interface {
+	ListOpsGroups(ctx context.Context) ([]string, error)
+	ListOpsGroupsWithUser(ctx context.Context, user string) ([]string, error)
+	ListUsers(ctx context.Context, group string) ([]string, error)
+	QueryOpsGroupOwner(ctx context.Context, group string) (string, error)
+	QueryResOpsGroupById(ctx context.Context, id int64) (*OpsGroup, error)
+	QueryResOpsGroupByTypeAndName(ctx context.Context, rType, name string) (*OpsGroup, error)
+	DeliverRes(ctx context.Context, targetGroup string, id int64) (bool, error)
+}
+
+// CMDB is implemented by Client. Depend on it, or on the narrower
+// interfaces, to substitute fakes or decorators. Client.NewBatch isn't part of
+// it, as a Batch is bound to the Client that sends it; code that batches calls
+// depends on the Client itself.
+type CMDB interface {
+	Querier
+	Mutator
+	GroupService
+
+	// Use adds middlewares around the calls, see Client.Use.
+	Use(mws ...Middleware)
+	BreakerState() BreakerState
+	Traverse(ctx context.Context, root int64, opts TraverseOptions) (*Graph, error)
+	BulkUpdate(ctx context.Context, attrs map[int64]Attr, opts BulkOptions) (*BulkResult[bool], error)
+	BulkDelete(ctx context.Context, ids []int64, opts BulkOptions) (*BulkResult[bool], error)
+	BulkDeliver(ctx context.Context, targetGroup string, ids []int64, opts BulkOptions) (*BulkResult[bool], error)
+	BulkQueryByIds(ctx context.Context, ids []int64, opts BulkOptions) (*BulkResult[*Resource], error)
+	Close()
+}
+
+var _ CMDB = (*Client)(nil)
@@ -0,0 +1,84 @@
+package apollo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func record(name string, trace *[]string) apollo.Middleware {
+	return func(next apollo.Invoker) apollo.Invoker {
+		return func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+			*trace = append(*trace, name+" "+method)
+			return next(ctx, method, params)
+		}
+	}
+}
+
+func TestMiddlewares(t *testing.T) {
+	var trace []string
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Middlewares = []apollo.Middleware{record("a", &trace), record("b", &trace)}
+	})
+	cli.Use(record("c", &trace))
+	srv.AddType("host")
+
+	if _, err := cli.ListTypes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a query.ci.types", "b query.ci.types", "c query.ci.types"}
+	if !slices.Equal(trace, want) {
+		t.Errorf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	errDenied := errors.New("denied")
+	deny := func(next apollo.Invoker) apollo.Invoker {
+		return func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+			if method == "delete.resource" {
+				return nil, errDenied
+			}
+			return next(ctx, method, params)
+		}
+	}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Middlewares = []apollo.Middleware{deny}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	if _, err := cli.DeleteById(context.Background(), host.ID); !errors.Is(err, errDenied) {
+		t.Errorf("DeleteById = %v, want the middleware error", err)
+	}
+	if calls(srv, "delete.resource") != 0 {
+		t.Error("the denied call reached the server")
+	}
+}
+
+// readOnly is a decorator of the CMDB interface refusing mutations.
+type readOnly struct {
+	apollo.CMDB
+}
+
+func (readOnly) DeleteById(context.Context, int64) (bool, error) {
+	return false, errors.New("read-only")
+}
+
+func TestCMDBDecorator(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	var db apollo.CMDB = readOnly{cli}
+	if _, err := db.DeleteById(context.Background(), host.ID); err == nil {
+		t.Error("DeleteById went through the decorator")
+	}
+	res, err := db.QueryResById(context.Background(), host.ID)
+	if err != nil || res.ID != host.ID {
+		t.Errorf("QueryResById = %v, %v", res, err)
+	}
+}
@@ -0,0 +1,81 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestInvoke(t *testing.T) {
+	var trace []string
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Middlewares = []apollo.Middleware{record("mw", &trace)}
+	})
+	srv.AddType("host")
+	srv.AddType("mysql")
+
+	types, err := apollo.Invoke[[]string](context.Background(), cli, "query.ci.types", nil)
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if !slices.Equal(types, []string{"host", "mysql"}) {
+		t.Errorf("types = %v", types)
+	}
+	if !slices.Equal(trace, []string{"mw query.ci.types"}) {
+		t.Errorf("trace = %v, want the call to go through the middlewares", trace)
+	}
+}
+
+func TestInvokeOwnType(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	host := srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"cpu": 8}), "dba")
+
+	type hostCI struct {
+		ID    int64 `json:"id"`
+		Attrs struct {
+			Name string `json:"name"`
+			CPU  int    `json:"cpu"`
+		} `json:"attributes"`
+	}
+	got, err := apollo.Invoke[*hostCI](context.Background(), cli, "query.resource", map[string]any{"id": host.ID})
+	if err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if got.ID != host.ID || got.Attrs.Name != "db01" || got.Attrs.CPU != 8 {
+		t.Errorf("result = %+v", got)
+	}
+
+	// A null result is a zero value, not a nil pointer.
+	got, err = apollo.Invoke[*hostCI](context.Background(), cli, "query.resource", map[string]any{"id": 999})
+	if err != nil || got == nil || got.ID != 0 {
+		t.Errorf("Invoke of a missing resource = %+v, %v", got, err)
+	}
+}
+
+func TestInvokeErrors(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+
+	_, err := apollo.Invoke[any](context.Background(), cli, "query.audit", nil)
+	if !errors.Is(err, apollo.ErrMethodNotFound) {
+		t.Errorf("err = %v, want ErrMethodNotFound", err)
+	}
+
+	srv.AddType("host")
+	srv.Inject(apollotest.Fault{Method: "query.ci.types", Status: http.StatusServiceUnavailable, Times: 1})
+	if _, err = apollo.Invoke[[]string](context.Background(), cli, "query.ci.types", nil); err != nil {
+		t.Fatalf("Invoke wasn't retried: %v", err)
+	}
+	if n := calls(srv, "query.ci.types"); n != 2 {
+		t.Errorf("attempts = %d, want 2", n)
+	}
+
+	_, err = apollo.Invoke[int](context.Background(), cli, "query.ci.types", nil)
+	if !errors.Is(err, apollo.JsonMarshalFailed) {
+		t.Errorf("err = %v, want a decode error", err)
+	}
+}
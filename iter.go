@@ -0,0 +1,304 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Iter runs q through query.resource and yields the resources as they are
+// decoded from the response, so that memory stays bounded whatever the size
+// of the result. When q has a Limit, the result is fetched page by page from
+// q's Page until a short or empty page is returned. Paging also stops when a
+// page starts with the same resource as an earlier one or brings no resource
+// missing from the previous page, as servers ignoring the page param do.
+//
+// Iteration stops at the first error, which is yielded with a nil resource.
+func (c *Client) Iter(ctx context.Context, q *Query) iter.Seq2[*Resource, error] {
+	return func(yield func(*Resource, error) bool) {
+		if err := c.validate(q); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		if q.single() {
+			res, err := c.Find(ctx, q)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, r := range res {
+				if !yield(r, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		pq := *q
+		pq.page = max(q.page, 1)
+		var (
+			firsts = make(map[int64]struct{})
+			prev   map[int64]struct{}
+		)
+		for {
+			var (
+				cur      = make(map[int64]struct{}, pq.limit)
+				fresh    bool
+				repeated bool
+			)
+			n, ok := c.iterPage(ctx, &pq, func(r *Resource, err error) bool {
+				if err != nil {
+					return yield(nil, err)
+				}
+				if len(cur) == 0 {
+					if _, dup := firsts[r.ID]; dup {
+						repeated = true
+						return false
+					}
+					firsts[r.ID] = struct{}{}
+				}
+				cur[r.ID] = struct{}{}
+				if _, dup := prev[r.ID]; !dup {
+					fresh = true
+				}
+				return yield(r, nil)
+			})
+			if !ok || repeated || pq.limit == 0 || n < pq.limit || !fresh {
+				if repeated {
+					c.log.Info("apollo returned a page twice, stop paging", "query", &pq)
+				}
+				return
+			}
+			prev = cur
+			pq.page++
+		}
+	}
+}
+
+func (c *Client) IterResByType(ctx context.Context, rType string) iter.Seq2[*Resource, error] {
+	return c.Iter(ctx, NewQuery().Type(rType))
+}
+
+func (c *Client) IterResByGroupAndType(ctx context.Context, rType, group string) iter.Seq2[*Resource, error] {
+	return c.Iter(ctx, NewQuery().Type(rType).Group(group))
+}
+
+// iterPage streams one response. It returns the number of resources yielded
+// and false when the iteration must stop.
+func (c *Client) iterPage(ctx context.Context, q *Query, yield func(*Resource, error) bool) (n int, ok bool) {
+	const method = "query.resource"
+
+	var (
+		params = q.params()
+		start  = time.Now()
+		stats  = CallStats{Method: method}
+		err    error
+	)
+	ctx, end := c.startTrace(ctx, method, params)
+	defer func() {
+		if err == errStopIter {
+			err = nil
+		}
+		c.observe(&stats, start, err)
+		end(stats, err)
+	}()
+
+	req, err := c.encode(method, params)
+	if err != nil {
+		yield(nil, err)
+		return 0, false
+	}
+	req.stream = true
+	stats.RequestBytes = len(req.body)
+
+	var resp *http.Response
+	err = c.withRetry(ctx, method, func() error {
+		resp, err = c.send(ctx, req)
+		stats.Status = statusOf(err)
+		return err
+	})
+	if err != nil {
+		c.log.Error(err, "fail to query resource", "query", q)
+		yield(nil, err)
+		return 0, false
+	}
+	defer resp.Body.Close()
+	stats.Status = resp.StatusCode
+
+	body := &countingReader{r: resp.Body}
+	n, err = streamResources(body, func(r *Resource) bool {
+		return yield(r, nil)
+	})
+	stats.ResponseBytes = body.n
+	if err == errStopIter {
+		return n, false
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		switch {
+		case body.err != nil && body.err != io.EOF:
+			// the connection failed or stalled, the payload may be fine.
+			err = body.err
+		case !errors.As(err, &rpcErr):
+			err = &DecodeError{Method: method, Err: err}
+		}
+		c.log.Error(err, "fail to decode resources", "query", q)
+		yield(nil, err)
+		return n, false
+	}
+	return n, true
+}
+
+var errStopIter = errors.New("iteration stopped")
+
+// idleTimeout cancels a streamed request when its response headers or a read
+// of its body take longer than d. Unlike http.Client.Timeout, it doesn't
+// bound the time spent reading and consuming a large response.
+type idleTimeout struct {
+	d      time.Duration
+	timer  *time.Timer
+	cancel context.CancelFunc
+	fired  atomic.Bool
+}
+
+func withIdleTimeout(ctx context.Context, d time.Duration) (context.Context, *idleTimeout) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &idleTimeout{d: d, cancel: cancel}
+	t.timer = time.AfterFunc(d, func() {
+		t.fired.Store(true)
+		cancel()
+	})
+	return ctx, t
+}
+
+func (t *idleTimeout) stop() {
+	if t == nil {
+		return
+	}
+	t.timer.Stop()
+	t.cancel()
+}
+
+// wrap turns the error of a request canceled by t into a timeout error,
+// keeping the *url.Error of http.Client.Do.
+func (t *idleTimeout) wrap(err error) error {
+	if t == nil || err == nil || !t.fired.Load() {
+		return err
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.Err = &streamTimeoutError{d: t.d}
+		return err
+	}
+	return &streamTimeoutError{d: t.d}
+}
+
+type idleBody struct {
+	rc   io.ReadCloser
+	idle *idleTimeout
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	b.idle.timer.Reset(b.idle.d)
+	n, err := b.rc.Read(p)
+	b.idle.timer.Stop()
+	return n, b.idle.wrap(err)
+}
+
+func (b *idleBody) Close() error {
+	b.idle.stop()
+	return b.rc.Close()
+}
+
+// streamTimeoutError is a net.Error, so that the retry policy and the
+// circuit breaker treat it like the other timeouts.
+type streamTimeoutError struct {
+	d time.Duration
+}
+
+func (e *streamTimeoutError) Error() string {
+	return fmt.Sprintf("apollo: no response data for %v", e.d)
+}
+
+func (e *streamTimeoutError) Timeout() bool   { return true }
+func (e *streamTimeoutError) Temporary() bool { return true }
+
+// streamResources decodes a JSON-RPC response whose result is an array of
+// resources, one element at a time.
+func streamResources(r io.Reader, yield func(*Resource) bool) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+
+		switch tok {
+		case "result":
+			tok, err = dec.Token()
+			if err != nil {
+				return n, err
+			}
+			if tok == nil {
+				continue
+			}
+			if tok != json.Delim('[') {
+				return n, fmt.Errorf("result is %v, want an array", tok)
+			}
+			for dec.More() {
+				var re Resource
+				if err = dec.Decode(&re); err != nil {
+					return n, err
+				}
+				if re.Rel == nil {
+					re.Rel = make(map[string][]Resource)
+				}
+				n++
+				if !yield(&re) {
+					return n, errStopIter
+				}
+			}
+			if err = expectDelim(dec, ']'); err != nil {
+				return n, err
+			}
+		case "error":
+			var rpcErr *RPCError
+			if err = dec.Decode(&rpcErr); err != nil {
+				return n, err
+			}
+			if rpcErr != nil {
+				return n, rpcErr
+			}
+		default:
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("got %v, want %v", tok, d)
+	}
+	return nil
+}
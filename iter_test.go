@@ -0,0 +1,178 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func collect(t *testing.T, seq func(func(*apollo.Resource, error) bool)) ([]int64, error) {
+	t.Helper()
+
+	var ids []int64
+	for r, err := range seq {
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+func TestIterPages(t *testing.T) {
+	for _, total := range []int{0, 3, 4, 5} {
+		t.Run(fmt.Sprint(total), func(t *testing.T) {
+			cli, srv := newTestClient(t, nil)
+			for i := range total {
+				srv.AddResource(apollotest.Res("host", fmt.Sprintf("h%d", i), nil), "dba")
+			}
+
+			ids, err := collect(t, cli.Iter(context.Background(), apollo.NewQuery().Type("host").Limit(2)))
+			if err != nil {
+				t.Fatalf("Iter: %v", err)
+			}
+			if len(ids) != total {
+				t.Errorf("got %d resources, want %d", len(ids), total)
+			}
+			// a full last page needs one more, empty, page to end.
+			if want := total/2 + 1; calls(srv, "query.resource") != want {
+				t.Errorf("pages = %d, want %d", calls(srv, "query.resource"), want)
+			}
+		})
+	}
+}
+
+func TestIterBreak(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	for i := range 10 {
+		srv.AddResource(apollotest.Res("host", fmt.Sprintf("h%d", i), nil), "dba")
+	}
+
+	n := 0
+	for _, err := range cli.Iter(context.Background(), apollo.NewQuery().Type("host").Limit(2)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if got := calls(srv, "query.resource"); got != 2 {
+		t.Errorf("pages = %d, want 2", got)
+	}
+}
+
+func TestIterIgnoredPage(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[{"id":1},{"id":2}]}`)
+	}))
+	defer srv.Close()
+
+	cfg := apollo.DefaultConfig()
+	cfg.Url = srv.URL
+	cfg.Token = testToken
+	cfg.Logger = apollo.DiscardLogger
+	cli, err := apollo.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	ids, err := collect(t, cli.Iter(context.Background(), apollo.NewQuery().Type("host").Limit(2)))
+	if err != nil {
+		t.Fatalf("Iter: %v", err)
+	}
+	if len(ids) != 2 || requests != 2 {
+		t.Errorf("got %v in %d requests, want [1 2] in 2", ids, requests)
+	}
+}
+
+func TestIterInvalid(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Schemas = map[string][]string{"host": {"name"}}
+	})
+
+	_, err := collect(t, cli.Iter(context.Background(), apollo.NewQuery().Type("host").Where(apollo.Eq("idc", "sh"))))
+	if !errors.Is(err, apollo.ErrUnknownField) {
+		t.Errorf("Iter = %v, want ErrUnknownField", err)
+	}
+	_, err = collect(t, cli.Iter(context.Background(), apollo.NewQuery()))
+	if !errors.Is(err, apollo.ErrInvalidQuery) {
+		t.Errorf("Iter = %v, want ErrInvalidQuery", err)
+	}
+	if n := len(srv.Calls()); n != 0 {
+		t.Errorf("calls = %d, want 0", n)
+	}
+}
+
+func TestIterRPCError(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	srv.FailNext("query.resource", apollo.CodeInternalError, "boom")
+
+	_, err := collect(t, cli.IterResByType(context.Background(), "host"))
+	if !errors.Is(err, apollo.ErrInternal) {
+		t.Errorf("Iter = %v, want ErrInternal", err)
+	}
+}
+
+func TestIterSlowConsumer(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Timeout = 50 * time.Millisecond
+	})
+	for i := range 500 {
+		srv.AddResource(apollotest.Res("host", fmt.Sprintf("h%d", i), nil), "dba")
+	}
+
+	// Consuming the page takes longer than the client timeout.
+	n := 0
+	for _, err := range cli.Iter(context.Background(), apollo.NewQuery().Type("host").Limit(1000)) {
+		if err != nil {
+			t.Fatalf("Iter after %d resources: %v", n, err)
+		}
+		if n++; n%100 == 0 {
+			time.Sleep(30 * time.Millisecond)
+		}
+	}
+	if n != 500 {
+		t.Errorf("got %d resources, want 500", n)
+	}
+}
+
+func TestIterStalledResponse(t *testing.T) {
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Timeout = 20 * time.Millisecond
+		c.Transport = apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				fmt.Fprint(pw, `{"jsonrpc":"2.0","id":1,"result":[{"id":1},`)
+				<-req.Context().Done()
+				pw.CloseWithError(req.Context().Err())
+			}()
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: pr, Request: req}, nil
+		})
+	})
+
+	ids, err := collect(t, cli.Iter(context.Background(), apollo.NewQuery().Type("host").Limit(10)))
+	if len(ids) != 1 {
+		t.Errorf("got %v before the stall, want [1]", ids)
+	}
+	var de *apollo.DecodeError
+	if errors.As(err, &de) {
+		t.Errorf("err = %v, want a transport error, not a DecodeError", err)
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() || !apollo.IsRetryable(err) {
+		t.Errorf("err = %v, want a retryable timeout", err)
+	}
+}
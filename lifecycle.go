@@ -0,0 +1,196 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal state transition")
+	ErrNotUpdated        = errors.New("resource not updated")
+)
+
+// Transition describes a state change of a resource.
+type Transition struct {
+	ID   int64
+	Type string
+	From State
+	To   State
+}
+
+// TransitionError is returned by Client.TransitionState for a move the
+// Lifecycle doesn't allow. It matches ErrIllegalTransition with errors.Is.
+type TransitionError struct {
+	Transition
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("apollo: illegal transition of %s %d from %q to %q", e.Type, e.ID, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+// TransitionHook runs around a state change. An error returned by a before
+// hook aborts the transition.
+type TransitionHook func(ctx context.Context, t Transition) error
+
+// Lifecycle defines the allowed state transitions of resources, with optional
+// overrides per CI type. Resources without a state, or in UnknownS, can move
+// to any state.
+type Lifecycle struct {
+	mu     sync.RWMutex
+	rules  map[State][]State
+	byType map[string]map[State][]State
+	before []TransitionHook
+	after  []TransitionHook
+}
+
+func NewLifecycle(rules map[State][]State) *Lifecycle {
+	return &Lifecycle{
+		rules:  maps.Clone(rules),
+		byType: make(map[string]map[State][]State),
+	}
+}
+
+// DefaultLifecycle follows the asset lifecycle of the state constants:
+//
+//	pre_install -> inventory -> test -> online <-> onjob -> resigning -> RESIGNED
+//
+// with offline reachable from, and returning to, the working states.
+func DefaultLifecycle() *Lifecycle {
+	return NewLifecycle(map[State][]State{
+		PreInstall:       {PreInstallFailed, Inventory, Test},
+		PreInstallFailed: {PreInstall, Offline},
+		Inventory:        {PreInstall, Test, Online, Offline},
+		Test:             {Inventory, Online, Offline},
+		Online:           {OnJob, Test, Offline, Resigning},
+		OnJob:            {Online, Offline, Resigning},
+		Offline:          {PreInstall, Inventory, Online, Resigning},
+		Resigning:        {Online, Resigned},
+		Resigned:         {},
+	})
+}
+
+// SetTypeRules replaces the transitions of resources of type rType.
+func (l *Lifecycle) SetTypeRules(rType string, rules map[State][]State) *Lifecycle {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.byType[rType] = maps.Clone(rules)
+	return l
+}
+
+func (l *Lifecycle) Before(hook TransitionHook) *Lifecycle {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.before = append(l.before, hook)
+	return l
+}
+
+func (l *Lifecycle) After(hook TransitionHook) *Lifecycle {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.after = append(l.after, hook)
+	return l
+}
+
+// Next returns the states a resource of type rType can move to from state.
+func (l *Lifecycle) Next(rType string, from State) []State {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if from == "" || from == UnknownS {
+		return StateValues()
+	}
+
+	rules, ok := l.byType[rType]
+	if !ok {
+		rules = l.rules
+	}
+	return slices.Clone(rules[from])
+}
+
+func (l *Lifecycle) Can(rType string, from, to State) bool {
+	return from == to || slices.Contains(l.Next(rType, from), to)
+}
+
+func (l *Lifecycle) hooks() (before, after []TransitionHook) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return slices.Clone(l.before), slices.Clone(l.after)
+}
+
+// TransitionState moves the resource id to state to. It reads the current
+// state, checks the move against the client Lifecycle, runs the before hooks,
+// updates the resource and runs the after hooks. Moving to the current state
+// is a no-op.
+//
+// The transition isn't atomic: Apollo has no conditional update, so the state
+// is read and written by two calls and a concurrent change in between is
+// overwritten without being checked against the Lifecycle. Serialize the
+// transitions of a resource on the caller side when that matters.
+func (c *Client) TransitionState(ctx context.Context, id int64, to State) error {
+	if !to.IsValid() {
+		return &EnumError{Type: "State", Value: string(to)}
+	}
+
+	res, err := c.QueryResById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if res.ID == 0 {
+		return fmt.Errorf("%w: resource %d", ErrNotFound, id)
+	}
+
+	var from State
+	if s, ok := res.Attrs["state"].(string); ok && s != "" {
+		if from, err = ParseState(s); err != nil {
+			c.log.Error(err, "resource has an invalid state", "id", id)
+			return err
+		}
+	}
+
+	t := Transition{ID: id, Type: res.Type.Name, From: from, To: to}
+	if from == to {
+		return nil
+	}
+	if !c.lifecycle.Can(t.Type, from, to) {
+		err = &TransitionError{Transition: t}
+		c.log.Error(err, "refuse state transition", "id", id, "from", from, "to", to)
+		return err
+	}
+
+	before, after := c.lifecycle.hooks()
+	for _, hook := range before {
+		if err = hook(ctx, t); err != nil {
+			c.log.Error(err, "state transition aborted by hook", "id", id, "from", from, "to", to)
+			return err
+		}
+	}
+
+	ok, err := c.UpdateResById(ctx, id, Attr{"state": to})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: state of resource %d", ErrNotUpdated, id)
+	}
+
+	var errs []error
+	for _, hook := range after {
+		if err = hook(ctx, t); err != nil {
+			c.log.Error(err, "state transition hook failed", "id", id, "from", from, "to", to)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
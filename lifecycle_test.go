@@ -0,0 +1,91 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestLifecycleCan(t *testing.T) {
+	l := apollo.DefaultLifecycle().SetTypeRules("switch", map[apollo.State][]apollo.State{
+		apollo.Online: {apollo.Offline},
+	})
+
+	tests := []struct {
+		rType    string
+		from, to apollo.State
+		want     bool
+	}{
+		{"host", apollo.Online, apollo.OnJob, true},
+		{"host", apollo.Online, apollo.Online, true},
+		{"host", apollo.Resigned, apollo.Online, false},
+		{"host", "", apollo.Resigned, true},
+		{"host", apollo.UnknownS, apollo.Test, true},
+		{"switch", apollo.Online, apollo.OnJob, false},
+		{"switch", apollo.Online, apollo.Offline, true},
+	}
+	for _, tt := range tests {
+		if got := l.Can(tt.rType, tt.from, tt.to); got != tt.want {
+			t.Errorf("Can(%s, %s, %s) = %v, want %v", tt.rType, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionState(t *testing.T) {
+	var before, after []apollo.Transition
+	lc := apollo.DefaultLifecycle().
+		Before(func(_ context.Context, tr apollo.Transition) error {
+			before = append(before, tr)
+			if tr.To == apollo.Resigning {
+				return errors.New("vetoed")
+			}
+			return nil
+		}).
+		After(func(_ context.Context, tr apollo.Transition) error {
+			after = append(after, tr)
+			return nil
+		})
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Lifecycle = lc
+	})
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", apollo.Attr{"state": ":online"}), "dba")
+
+	state := func() any {
+		r, _ := srv.Resource(host.ID)
+		return r.Attrs["state"]
+	}
+
+	if err := cli.TransitionState(ctx, host.ID, apollo.OnJob); err != nil {
+		t.Fatalf("TransitionState(onjob): %v", err)
+	}
+	if state() != ":onjob" {
+		t.Errorf("state = %v, want :onjob", state())
+	}
+	if len(before) != 1 || len(after) != 1 || after[0].From != apollo.Online || after[0].To != apollo.OnJob {
+		t.Errorf("hooks ran with before %v, after %v", before, after)
+	}
+
+	err := cli.TransitionState(ctx, host.ID, apollo.PreInstall)
+	var te *apollo.TransitionError
+	if !errors.As(err, &te) || !errors.Is(err, apollo.ErrIllegalTransition) || te.From != apollo.OnJob {
+		t.Errorf("TransitionState(pre_install) = %v, want a TransitionError", err)
+	}
+
+	if err = cli.TransitionState(ctx, host.ID, apollo.Resigning); err == nil || err.Error() != "vetoed" {
+		t.Errorf("TransitionState(resigning) = %v, want the hook error", err)
+	}
+	if state() != ":onjob" {
+		t.Errorf("state = %v after refused transitions, want :onjob", state())
+	}
+
+	if err = cli.TransitionState(ctx, host.ID+100, apollo.Online); !apollo.IsNotFound(err) {
+		t.Errorf("TransitionState(missing) = %v, want ErrNotFound", err)
+	}
+	if err = cli.TransitionState(ctx, host.ID, "bogus"); !errors.Is(err, apollo.ErrInvalidEnum) {
+		t.Errorf("TransitionState(bogus) = %v, want ErrInvalidEnum", err)
+	}
+}
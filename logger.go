@@ -1,8 +1,10 @@
 package apollo
 
 import (
+	"context"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
@@ -23,21 +25,47 @@ type Logger interface {
 	Error(err error, msg string, keysAndValues ...interface{})
 }
 
+// DebugLogger is implemented by loggers with a debug level. The client logs
+// request payloads at this level only. Loggers can also implement
+// DebugEnabled() bool so that the payloads aren't rendered while the level is
+// disabled.
+type DebugLogger interface {
+	Logger
+	// Debug logs a message useful when debugging.
+	Debug(msg string, keysAndValues ...interface{})
+}
+
 // PrintfLogger wraps a Printf-based logger (such as the standard library "log")
 // into an implementation of the Logger interface which logs errors only.
 func PrintfLogger(l interface{ Printf(string, ...interface{}) }) Logger {
-	return printfLogger{l, false}
+	return printfLogger{l, false, false}
 }
 
 // VerbosePrintfLogger wraps a Printf-based logger (such as the standard library
 // "log") into an implementation of the Logger interface which logs everything.
 func VerbosePrintfLogger(l interface{ Printf(string, ...interface{}) }) Logger {
-	return printfLogger{l, true}
+	return printfLogger{l, true, false}
+}
+
+// DebugPrintfLogger is like VerbosePrintfLogger and also logs debug messages.
+func DebugPrintfLogger(l interface{ Printf(string, ...interface{}) }) Logger {
+	return printfLogger{l, true, true}
 }
 
 type printfLogger struct {
-	logger  interface{ Printf(string, ...interface{}) }
-	logInfo bool
+	logger   interface{ Printf(string, ...interface{}) }
+	logInfo  bool
+	logDebug bool
+}
+
+func (pl printfLogger) Debug(msg string, keysAndValues ...interface{}) {
+	if pl.logDebug {
+		pl.Info(msg, keysAndValues...)
+	}
+}
+
+func (pl printfLogger) DebugEnabled() bool {
+	return pl.logDebug
 }
 
 func (pl printfLogger) Info(msg string, keysAndValues ...interface{}) {
@@ -84,3 +112,29 @@ func formatTimes(keysAndValues []interface{}) []interface{} {
 	}
 	return formattedArgs
 }
+
+// SlogLogger adapts a log/slog handler to the Logger interface. Debug
+// messages are logged at slog.LevelDebug.
+func SlogLogger(h slog.Handler) Logger {
+	return slogLogger{slog.New(h)}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (sl slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	sl.logger.Info(msg, keysAndValues...)
+}
+
+func (sl slogLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	sl.logger.Error(msg, append([]interface{}{"error", err}, keysAndValues...)...)
+}
+
+func (sl slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	sl.logger.Debug(msg, keysAndValues...)
+}
+
+func (sl slogLogger) DebugEnabled() bool {
+	return sl.logger.Enabled(context.Background(), slog.LevelDebug)
+}
@@ -0,0 +1,72 @@
+package apollo_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Logger = apollo.SlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		c.MaxLogBytes = -1
+	})
+	srv.AddGroup(apollo.OpsGroup{Name: "dba"})
+
+	res := apollotest.Res("host", "db01", apollo.Attr{"root_password": "hunter2", "cpu": 8})
+	if _, err := cli.CreateRes(context.Background(), res, "dba"); err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNext("query.ci.types", apollo.CodeInternalError, "boom")
+	_, _ = cli.ListTypes(context.Background())
+
+	out := buf.String()
+	if !strings.Contains(out, "level=DEBUG msg=reqBody method=create.resource") {
+		t.Errorf("no debug payload in logs:\n%s", out)
+	}
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, `root_password\":\"[REDACTED]`) {
+		t.Errorf("password not redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "boom") {
+		t.Errorf("no error in logs:\n%s", out)
+	}
+}
+
+func TestDebugDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Logger = apollo.SlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	})
+	srv.AddType("host")
+
+	if _, err := cli.ListTypes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "reqBody") {
+		t.Errorf("debug payload logged at info level:\n%s", buf.String())
+	}
+}
+
+func TestPrintfLoggerTruncates(t *testing.T) {
+	var buf bytes.Buffer
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Logger = apollo.DebugPrintfLogger(log.New(&buf, "", 0))
+		c.MaxLogBytes = 16
+	})
+	srv.AddGroup(apollo.OpsGroup{Name: "dba"})
+
+	res := apollotest.Res("host", "db01", apollo.Attr{"description": strings.Repeat("x", 100)})
+	if _, err := cli.CreateRes(context.Background(), res, "dba"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "bytes truncated)") || strings.Contains(buf.String(), strings.Repeat("x", 100)) {
+		t.Errorf("payload not truncated:\n%s", buf.String())
+	}
+}
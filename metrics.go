@@ -0,0 +1,110 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Outcomes of a call reported to Metrics.
+const (
+	OutcomeOK          = "ok"
+	OutcomeRPCError    = "rpc_error"
+	OutcomeHTTPError   = "http_error"
+	OutcomeDecodeError = "decode_error"
+	OutcomeTimeout     = "timeout"
+	OutcomeRateLimited = "rate_limited"
+	OutcomeCircuitOpen = "circuit_open"
+	OutcomeCanceled    = "canceled"
+	// OutcomeTransportError is a request that got no HTTP response, e.g. a
+	// connection error.
+	OutcomeTransportError = "transport_error"
+	// OutcomeTokenError is a failure of the TokenSource.
+	OutcomeTokenError = "token_error"
+	// OutcomeError is any other error, e.g. params that can't be encoded.
+	OutcomeError = "error"
+)
+
+// CallStats describes one JSON-RPC call, retries included.
+type CallStats struct {
+	Method  string
+	Outcome string
+	// Status is the HTTP status of the last attempt, 0 if none was received.
+	Status        int
+	Duration      time.Duration
+	RequestBytes  int
+	ResponseBytes int
+}
+
+// Metrics collects statistics about the calls of a Client. See the
+// apolloprom package for a Prometheus implementation.
+type Metrics interface {
+	ObserveCall(s CallStats)
+}
+
+func (c *Client) observe(s *CallStats, start time.Time, err error) {
+	s.Duration = time.Since(start)
+	s.Outcome = outcomeOf(err)
+	if c.metrics != nil {
+		c.metrics.ObserveCall(*s)
+	}
+}
+
+func outcomeOf(err error) string {
+	var (
+		rpcErr *RPCError
+		he     *HTTPError
+		te     *tokenError
+		netErr net.Error
+		urlErr *url.Error
+	)
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.As(err, &rpcErr):
+		return OutcomeRPCError
+	case errors.Is(err, ErrRateLimited), errors.As(err, &he) && he.StatusCode == http.StatusTooManyRequests:
+		return OutcomeRateLimited
+	case errors.Is(err, ErrCircuitOpen):
+		return OutcomeCircuitOpen
+	case errors.Is(err, JsonMarshalFailed):
+		return OutcomeDecodeError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return OutcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case errors.As(err, &he):
+		return OutcomeHTTPError
+	case errors.As(err, &te):
+		return OutcomeTokenError
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return OutcomeTransportError
+	}
+	return OutcomeError
+}
+
+func statusOf(err error) int {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode
+	}
+	return 0
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+	// err is the last error of r.
+	err error
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	cr.err = err
+	return n, err
+}
@@ -0,0 +1,194 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats []apollo.CallStats
+}
+
+func (r *statsRecorder) ObserveCall(s apollo.CallStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats = append(r.stats, s)
+}
+
+func (r *statsRecorder) last(t *testing.T) apollo.CallStats {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.stats) == 0 {
+		t.Fatal("no call observed")
+	}
+	return r.stats[len(r.stats)-1]
+}
+
+func TestMetricsOutcomes(t *testing.T) {
+	rec := &statsRecorder{}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Metrics = rec
+	})
+	ctx := context.Background()
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	if _, err := cli.QueryResById(ctx, host.ID); err != nil {
+		t.Fatal(err)
+	}
+	s := rec.last(t)
+	if s.Method != "query.resource" || s.Outcome != apollo.OutcomeOK || s.Status != http.StatusOK ||
+		s.RequestBytes == 0 || s.ResponseBytes == 0 || s.Duration <= 0 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	tests := []struct {
+		name  string
+		fault func()
+		want  string
+	}{
+		{"rpc error", func() { srv.FailNext("query.resource", apollo.CodeInternalError, "boom") }, apollo.OutcomeRPCError},
+		{"http error", func() {
+			srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusInternalServerError, Times: 1})
+		}, apollo.OutcomeHTTPError},
+		{"too many requests", func() {
+			srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusTooManyRequests, Times: 1})
+		}, apollo.OutcomeRateLimited},
+	}
+	for _, tt := range tests {
+		tt.fault()
+		if _, err := cli.QueryResById(ctx, host.ID); err == nil {
+			t.Errorf("%s: QueryResById succeeded", tt.name)
+		}
+		if s = rec.last(t); s.Outcome != tt.want {
+			t.Errorf("%s: outcome = %q, want %q", tt.name, s.Outcome, tt.want)
+		}
+	}
+}
+
+func TestMetricsDecodeError(t *testing.T) {
+	rec := &statsRecorder{}
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Metrics = rec
+		c.Transport = apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("<html>")),
+				Request:    req,
+			}, nil
+		})
+	})
+
+	if _, err := cli.ListTypes(context.Background()); err == nil {
+		t.Fatal("ListTypes succeeded")
+	}
+	if s := rec.last(t); s.Outcome != apollo.OutcomeDecodeError || s.ResponseBytes != len("<html>") {
+		t.Errorf("stats = %+v, want outcome %q", s, apollo.OutcomeDecodeError)
+	}
+}
+
+func TestMetricsRateLimited(t *testing.T) {
+	rec := &statsRecorder{}
+	cli, _ := newTestClient(t, func(c *apollo.Config) {
+		c.Metrics = rec
+		c.RateLimit = apollo.RateLimit{Read: apollo.Limit{Rate: 0.001}, FailFast: true}
+	})
+
+	_, _ = cli.ListTypes(context.Background())
+	if _, err := cli.ListTypes(context.Background()); err == nil {
+		t.Fatal("second ListTypes wasn't rate limited")
+	}
+	if s := rec.last(t); s.Outcome != apollo.OutcomeRateLimited {
+		t.Errorf("outcome = %q, want %q", s.Outcome, apollo.OutcomeRateLimited)
+	}
+}
+
+func TestMetricsCircuitOpen(t *testing.T) {
+	rec := &statsRecorder{}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Metrics = rec
+		c.Breaker = apollo.BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Hour}
+	})
+
+	srv.Inject(apollotest.Fault{Status: http.StatusServiceUnavailable, Times: 1})
+	_, _ = cli.ListTypes(context.Background())
+	if _, err := cli.ListTypes(context.Background()); err == nil {
+		t.Fatal("ListTypes went through an open circuit")
+	}
+	if s := rec.last(t); s.Outcome != apollo.OutcomeCircuitOpen || s.Status != 0 {
+		t.Errorf("stats = %+v, want outcome %q without a status", s, apollo.OutcomeCircuitOpen)
+	}
+}
+
+func TestMetricsErrorOutcomes(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*apollo.Config)
+		ctx   func() (context.Context, context.CancelFunc)
+		want  string
+	}{
+		{
+			name: "caller cancel",
+			setup: func(c *apollo.Config) {
+				c.TransportMiddlewares = []apollo.TransportMiddleware{hang}
+			},
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(5*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: apollo.OutcomeCanceled,
+		},
+		{
+			name: "connection error",
+			setup: func(c *apollo.Config) {
+				c.Transport = apollo.RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+					return nil, errors.New("connection refused")
+				})
+			},
+			want: apollo.OutcomeTransportError,
+		},
+		{
+			name: "token error",
+			setup: func(c *apollo.Config) {
+				c.TokenSource = failingToken{}
+			},
+			want: apollo.OutcomeTokenError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &statsRecorder{}
+			cli, _ := newTestClient(t, func(c *apollo.Config) {
+				c.Metrics = rec
+				tt.setup(c)
+			})
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			if _, err := cli.ListTypes(ctx); err == nil {
+				t.Fatal("ListTypes succeeded")
+			}
+			if s := rec.last(t); s.Outcome != tt.want || s.Status != 0 {
+				t.Errorf("stats = %+v, want outcome %q without a status", s, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Invoker performs one JSON-RPC call and returns the raw result member of the
+// response.
+type Invoker func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error)
+
+// Middleware decorates an Invoker, e.g. to add logging, metrics or caching
+// around every call of a Client. The Iter methods stream their responses and
+// Batch.Send sends several calls at once, so they don't go through the
+// middlewares; use a Tracer or a TransportMiddleware to see them.
+type Middleware func(next Invoker) Invoker
+
+// Tracer starts a span around the requests that don't go through the
+// middlewares: each page of the Iter methods and each Batch.Send, whose method
+// is "rpc.batch". The returned context is the one of the request, and end is
+// called with its stats and error once it is done.
+type Tracer interface {
+	Start(ctx context.Context, method string, params map[string]any) (_ context.Context, end func(CallStats, error))
+}
+
+func (c *Client) startTrace(ctx context.Context, method string, params map[string]any) (context.Context, func(CallStats, error)) {
+	if c.tracer == nil {
+		return ctx, func(CallStats, error) {}
+	}
+	return c.tracer.Start(ctx, method, params)
+}
+
+// Chain composes middlewares so that the first one is the outermost.
+func Chain(mws ...Middleware) Middleware {
+	return func(next Invoker) Invoker {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Use wraps the client transport with mws, the first one being the
+// outermost. It must be called before the client is shared between
+// goroutines.
+func (c *Client) Use(mws ...Middleware) {
+	c.middlewares = append(c.middlewares, mws...)
+	c.invoke = Chain(c.middlewares...)(c.do)
+}
+
+// TransportMiddleware decorates the http.RoundTripper of a Client.
+type TransportMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newHTTPClient(c Config) *http.Client {
+	hc := &http.Client{Timeout: c.Timeout}
+	if c.HTTPClient != nil {
+		cp := *c.HTTPClient
+		hc = &cp
+		if hc.Timeout == 0 {
+			hc.Timeout = c.Timeout
+		}
+	}
+
+	if c.Transport != nil {
+		hc.Transport = c.Transport
+	}
+	if len(c.TransportMiddlewares) > 0 {
+		rt := hc.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		for i := len(c.TransportMiddlewares) - 1; i >= 0; i-- {
+			rt = c.TransportMiddlewares[i](rt)
+		}
+		hc.Transport = rt
+	}
+	return hc
+}
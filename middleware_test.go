@@ -0,0 +1,62 @@
+package apollo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+func TestTransportMiddlewares(t *testing.T) {
+	var (
+		order []string
+		seen  []string
+	)
+	header := func(name string) apollo.TransportMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return apollo.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				req = req.Clone(req.Context())
+				req.Header.Add("X-Trace", name)
+				seen = req.Header.Values("X-Trace")
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.TransportMiddlewares = []apollo.TransportMiddleware{header("outer"), header("inner")}
+	})
+	srv.AddType("host")
+
+	if _, err := cli.ListTypes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(order, []string{"outer", "inner"}) || !slices.Equal(seen, []string{"outer", "inner"}) {
+		t.Errorf("order = %v, headers = %v, want outer then inner", order, seen)
+	}
+}
+
+func TestUseThroughCMDB(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	srv.AddType("host")
+
+	var (
+		db      apollo.CMDB = cli
+		methods []string
+	)
+	db.Use(func(next apollo.Invoker) apollo.Invoker {
+		return func(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+			methods = append(methods, method)
+			return next(ctx, method, params)
+		}
+	})
+	if _, err := db.ListTypes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(methods, []string{"query.ci.types"}) {
+		t.Errorf("middleware saw %v, want [query.ci.types]", methods)
+	}
+}
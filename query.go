@@ -0,0 +1,266 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query describes a query.resource request. It is built with chained calls
+// and executed with Client.Find:
+//
+//	q := apollo.NewQuery().Type("host").Group("dba").Where(cond)
+//	res, err := cli.Find(ctx, q)
+type Query struct {
+	rType string
+	name  string
+	group string
+	cond  Cond
+
+	graph  string
+	target string
+
+	relationship string
+	secondary    string
+
+	referencedBy int64
+
+	page  int
+	limit int
+}
+
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// Type sets the CI type. Combined with Relationship it is the primary type.
+func (q *Query) Type(rType string) *Query {
+	q.rType = rType
+	return q
+}
+
+func (q *Query) Name(name string) *Query {
+	q.name = name
+	return q
+}
+
+// Group restricts the query to the resources of an ops group.
+func (q *Query) Group(group string) *Query {
+	q.group = group
+	return q
+}
+
+// Where adds attribute conditions. Repeated calls are combined with And.
+func (q *Query) Where(cond Cond) *Query {
+	if q.cond == nil {
+		q.cond = cond
+	} else {
+		q.cond = And(q.cond, cond)
+	}
+	return q
+}
+
+func (q *Query) Graph(graph string) *Query {
+	q.graph = graph
+	return q
+}
+
+func (q *Query) Target(target string) *Query {
+	q.target = target
+	return q
+}
+
+// Relationship selects the resources of secondaryType related to the
+// resources of the query type through relationship.
+func (q *Query) Relationship(relationship, secondaryType string) *Query {
+	q.relationship = relationship
+	q.secondary = secondaryType
+	return q
+}
+
+// ReferencedBy selects the resources whose relations reference the resource id.
+func (q *Query) ReferencedBy(id int64) *Query {
+	q.referencedBy = id
+	return q
+}
+
+// Page selects the 1-based page of the result. It needs Limit.
+func (q *Query) Page(page int) *Query {
+	q.page = page
+	return q
+}
+
+// Limit sets the page size. Client.Iter uses it to walk the result page by
+// page.
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+	return q
+}
+
+// Validate reports whether the combination of criteria is supported by
+// query.resource.
+func (q *Query) Validate() error {
+	var (
+		hasGraph = q.graph != "" || q.target != ""
+		hasRel   = q.relationship != "" || q.secondary != ""
+		hasRef   = q.referencedBy != 0
+		hasCond  = q.cond != nil
+	)
+
+	switch {
+	case hasRef:
+		if q.rType != "" || q.name != "" || q.group != "" || hasCond || hasGraph || hasRel {
+			return fmt.Errorf("%w: ReferencedBy can't be combined with other criteria", ErrInvalidQuery)
+		}
+	case hasGraph:
+		if q.graph == "" || q.target == "" {
+			return fmt.Errorf("%w: Graph and Target must be set together", ErrInvalidQuery)
+		}
+		if q.rType != "" || q.name != "" || q.group != "" || hasCond || hasRel {
+			return fmt.Errorf("%w: Graph/Target can't be combined with other criteria", ErrInvalidQuery)
+		}
+	case hasRel:
+		if q.rType == "" || q.relationship == "" || q.secondary == "" {
+			return fmt.Errorf("%w: Relationship requires Type and a secondary type", ErrInvalidQuery)
+		}
+		if q.name != "" || q.group != "" || hasCond {
+			return fmt.Errorf("%w: Relationship can't be combined with Name, Group or Where", ErrInvalidQuery)
+		}
+	case q.name != "":
+		if q.group != "" || hasCond {
+			return fmt.Errorf("%w: Name can't be combined with Group or Where", ErrInvalidQuery)
+		}
+	case q.rType == "":
+		return fmt.Errorf("%w: Type is required", ErrInvalidQuery)
+	}
+
+	if q.page < 0 || q.limit < 0 {
+		return fmt.Errorf("%w: Page and Limit can't be negative", ErrInvalidQuery)
+	}
+	if q.page > 0 && q.limit == 0 {
+		return fmt.Errorf("%w: Page requires Limit", ErrInvalidQuery)
+	}
+	if q.limit > 0 && q.single() {
+		return fmt.Errorf("%w: Type and Name select a single resource and can't be paged", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// single reports whether the server answers with one resource instead of a list.
+func (q *Query) single() bool {
+	return q.rType != "" && q.name != "" && q.relationship == ""
+}
+
+func (q *Query) params() map[string]any {
+	params := map[string]any{}
+
+	switch {
+	case q.referencedBy != 0:
+		params["referenced_id"] = q.referencedBy
+	case q.graph != "":
+		params["graph"] = q.graph
+		params["target"] = q.target
+	case q.relationship != "":
+		params["primary_type"] = q.rType
+		params["relationship"] = q.relationship
+		params["secondary_type"] = q.secondary
+	default:
+		if q.rType != "" {
+			params["type"] = q.rType
+		}
+		if q.name != "" {
+			params["name"] = q.name
+		}
+		if q.group != "" {
+			params["group_name"] = q.group
+		}
+		if q.cond != nil {
+			params["conditions"] = q.cond
+		}
+	}
+
+	if q.limit > 0 {
+		params["page"] = max(q.page, 1)
+		params["limit"] = q.limit
+	}
+	return params
+}
+
+func (q *Query) String() string {
+	var parts []string
+	add := func(k string, v any) {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	}
+
+	if q.rType != "" {
+		add("type", q.rType)
+	}
+	if q.name != "" {
+		add("name", q.name)
+	}
+	if q.group != "" {
+		add("group", q.group)
+	}
+	if q.cond != nil {
+		add("conditions", "["+q.cond.String()+"]")
+	}
+	if q.graph != "" || q.target != "" {
+		add("graph", q.graph)
+		add("target", q.target)
+	}
+	if q.relationship != "" || q.secondary != "" {
+		add("relationship", q.relationship)
+		add("secondary_type", q.secondary)
+	}
+	if q.referencedBy != 0 {
+		add("referenced_id", q.referencedBy)
+	}
+	if q.limit > 0 {
+		add("page", max(q.page, 1))
+		add("limit", q.limit)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Find runs q through query.resource.
+func (c *Client) Find(ctx context.Context, q *Query) ([]*Resource, error) {
+	if err := c.validate(q); err != nil {
+		return nil, err
+	}
+
+	r, err := c.call(ctx, "query.resource", q.params())
+	if err != nil {
+		c.log.Error(err, "fail to query resource", "query", q)
+		return nil, err
+	}
+
+	if q.single() {
+		if isNull(r) {
+			return make([]*Resource, 0), nil
+		}
+		res, err := decode[*Resource](c, "query.resource", r)
+		if err != nil {
+			return nil, err
+		}
+		return []*Resource{res}, nil
+	}
+	return decode[[]*Resource](c, "query.resource", r)
+}
+
+// validate checks q, and its conditions against the schema of its type when
+// one is configured.
+func (c *Client) validate(q *Query) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	if fields, ok := c.schemas[q.rType]; ok && q.cond != nil {
+		if err := ValidateCond(q.cond, fields); err != nil {
+			c.log.Error(err, "invalid query conditions", "query", q)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestQueryValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     *apollo.Query
+		valid bool
+	}{
+		{"type", apollo.NewQuery().Type("host"), true},
+		{"type and name", apollo.NewQuery().Type("host").Name("db01"), true},
+		{"no type", apollo.NewQuery().Group("dba"), false},
+		{"graph without target", apollo.NewQuery().Graph("g"), false},
+		{"graph and type", apollo.NewQuery().Graph("g").Target("t").Type("host"), false},
+		{"relationship", apollo.NewQuery().Type("host").Relationship("runs", "app"), true},
+		{"relationship and group", apollo.NewQuery().Type("host").Relationship("runs", "app").Group("dba"), false},
+		{"referenced by and type", apollo.NewQuery().ReferencedBy(1).Type("host"), false},
+		{"page without limit", apollo.NewQuery().Type("host").Page(2), false},
+		{"paged single", apollo.NewQuery().Type("host").Name("db01").Limit(10), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+			if !tt.valid && !errors.Is(err, apollo.ErrInvalidQuery) {
+				t.Errorf("Validate() = %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+	srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	srv.AddResource(apollotest.Res("host", "db02", nil), "web")
+	srv.AddResource(apollotest.Res("app", "api", nil), "dba")
+
+	res, err := cli.Find(ctx, apollo.NewQuery().Type("host").Group("dba"))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(res) != 1 || res[0].Attrs["name"] != "db01" {
+		t.Errorf("Find(type, group) = %v, want db01", res)
+	}
+
+	res, err = cli.Find(ctx, apollo.NewQuery().Type("host").Name("db02"))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if len(res) != 1 || res[0].Attrs["name"] != "db02" {
+		t.Errorf("Find(type, name) = %v, want db02", res)
+	}
+
+	res, err = cli.Find(ctx, apollo.NewQuery().Type("host").Name("missing"))
+	if err != nil || len(res) != 0 {
+		t.Errorf("Find(missing) = %v, %v, want no resource", res, err)
+	}
+
+	if _, err = cli.Find(ctx, apollo.NewQuery()); !errors.Is(err, apollo.ErrInvalidQuery) {
+		t.Errorf("Find(empty) = %v, want ErrInvalidQuery", err)
+	}
+	if n := len(srv.Calls()); n != 3 {
+		t.Errorf("calls = %d, want 3, invalid queries must not be sent", n)
+	}
+}
@@ -0,0 +1,161 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by fail-fast rate limits when a request would
+// have to wait.
+var ErrRateLimited = errors.New("apollo rate limit exceeded")
+
+// Limit is a token bucket allowing Rate requests per second on average and
+// bursts of up to Burst requests. A zero Rate disables it.
+type Limit struct {
+	Rate float64
+	// Burst defaults to 1.
+	Burst int
+}
+
+// RateLimit throttles the HTTP requests of a Client, retries included.
+type RateLimit struct {
+	// Read limits the query.* methods.
+	Read Limit
+	// Write limits the other methods.
+	Write Limit
+	// FailFast returns ErrRateLimited instead of waiting for a token.
+	FailFast bool
+}
+
+// limiter applies a RateLimit, and the pauses requested by the server with
+// 429 responses.
+type limiter struct {
+	read, write *bucket
+	failFast    bool
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newLimiter(rl RateLimit) *limiter {
+	return &limiter{
+		read:     newBucket(rl.Read),
+		write:    newBucket(rl.Write),
+		failFast: rl.FailFast,
+	}
+}
+
+// wait blocks until a request of method may be sent.
+func (l *limiter) wait(ctx context.Context, method string) error {
+	b := l.write
+	if strings.HasPrefix(method, "query.") {
+		b = l.read
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	d := l.until.Sub(now)
+	l.mu.Unlock()
+
+	if l.failFast && d > 0 {
+		return ErrRateLimited
+	}
+	if b != nil {
+		w, ok := b.reserve(now, l.failFast)
+		if !ok {
+			return ErrRateLimited
+		}
+		d = max(d, w)
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		// The request won't be sent, give its token back.
+		if b != nil {
+			b.cancel()
+		}
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// pause holds every request for d.
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+type bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(l Limit) *bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(max(l.Burst, 1))
+	return &bucket{rate: l.Rate, burst: burst, tokens: burst}
+}
+
+// reserve takes a token and returns how long to wait for it. With failFast,
+// no token is taken and false is returned when none is available.
+func (b *bucket) reserve(now time.Time, failFast bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	if failFast && b.tokens < 1 {
+		return 0, false
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// cancel gives back a token taken by reserve.
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(max(s, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
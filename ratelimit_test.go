@@ -0,0 +1,104 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func TestRateLimitWaits(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.RateLimit.Read = apollo.Limit{Rate: 20, Burst: 1}
+	})
+	srv.AddType("host")
+
+	start := time.Now()
+	for range 3 {
+		if _, err := cli.ListTypes(context.Background()); err != nil {
+			t.Fatalf("ListTypes: %v", err)
+		}
+	}
+	// The burst lets the first request through, the next ones wait 50ms each.
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 100ms", d)
+	}
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.RateLimit = apollo.RateLimit{
+			Read:     apollo.Limit{Rate: 0.01, Burst: 1},
+			FailFast: true,
+		}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	if _, err := cli.QueryResById(context.Background(), host.ID); err != nil {
+		t.Fatalf("QueryResById: %v", err)
+	}
+	if _, err := cli.QueryResById(context.Background(), host.ID); !errors.Is(err, apollo.ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	if n := calls(srv, "query.resource"); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+
+	// Writes have their own, unlimited, bucket.
+	if _, err := cli.UpdateResById(context.Background(), host.ID, apollo.Attr{"cpu": 8}); err != nil {
+		t.Errorf("UpdateResById: %v", err)
+	}
+}
+
+func TestRateLimitRefundsCanceled(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.RateLimit.Read = apollo.Limit{Rate: 10, Burst: 1}
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	if _, err := cli.QueryResById(context.Background(), host.ID); err != nil {
+		t.Fatalf("QueryResById: %v", err)
+	}
+	// Each canceled request would push the next token 100ms further away if
+	// its reservation was kept.
+	for range 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, err := cli.QueryResById(ctx, host.ID)
+		cancel()
+		if err == nil {
+			t.Fatal("QueryResById succeeded while rate limited")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if _, err := cli.QueryResById(ctx, host.ID); err != nil {
+		t.Fatalf("QueryResById after canceled requests: %v", err)
+	}
+	if n := calls(srv, "query.resource"); n != 2 {
+		t.Errorf("server got %d requests, want 2", n)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.RateLimit.FailFast = true
+	})
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	srv.Inject(apollotest.Fault{Status: http.StatusTooManyRequests, RetryAfter: time.Minute, Times: 1})
+	_, err := cli.QueryResById(context.Background(), host.ID)
+	var he *apollo.HTTPError
+	if !errors.As(err, &he) || he.RetryAfter != time.Minute {
+		t.Fatalf("err = %v, want a 429 with a 1m Retry-After", err)
+	}
+
+	// The pause applies to every method.
+	if _, err = cli.UpdateResById(context.Background(), host.ID, apollo.Attr{"cpu": 8}); !errors.Is(err, apollo.ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+}
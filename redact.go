@@ -0,0 +1,80 @@
+package apollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// DefaultRedactKeys are the param and attribute names masked in the logs. A
+// key is masked when it contains one of them, ignoring case.
+var DefaultRedactKeys = []string{"token", "password", "passwd", "secret", "credential", "private_key"}
+
+// DefaultMaxLogBytes caps the size of the payloads written to the logs.
+const DefaultMaxLogBytes = 4096
+
+// debugLogger returns the logger of c when it logs debug messages.
+func (c *Client) debugLogger() (DebugLogger, bool) {
+	dl, ok := c.log.(DebugLogger)
+	if !ok {
+		return nil, false
+	}
+	if e, ok := c.log.(interface{ DebugEnabled() bool }); ok && !e.DebugEnabled() {
+		return nil, false
+	}
+	return dl, true
+}
+
+// logPayload renders v for the logs with the sensitive keys masked and the
+// result truncated to the configured size.
+func (c *Client) logPayload(v any) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+
+	var generic any
+	if err = json.Unmarshal(raw, &generic); err == nil {
+		if raw, err = json.Marshal(redactValue(generic, c.redactKeys)); err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+	}
+	return truncate(string(raw), c.maxLogBytes)
+}
+
+func redactValue(v any, keys []string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			if isSensitive(k, keys) {
+				t[k] = redacted
+			} else {
+				t[k] = redactValue(e, keys)
+			}
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = redactValue(e, keys)
+		}
+	}
+	return v
+}
+
+func isSensitive(key string, keys []string) bool {
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", s[:max], len(s)-max)
+}
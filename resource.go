@@ -64,16 +64,13 @@ type OpsUser struct {
 
 // ------- Response -------
 
-type R interface {
-	Resource | AggRes | AggResLeftJoin | OpsGroup | string | bool | []Resource | []string
-}
-
 type RespBase struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Id      int64  `json:"id"`
+	Jsonrpc string    `json:"jsonrpc"`
+	Id      int64     `json:"id"`
+	Error   *RPCError `json:"error,omitempty"`
 }
 
-type Resp[T R] struct {
+type Resp[T any] struct {
 	RespBase
 	Result T `json:"result"`
 }
@@ -82,7 +79,7 @@ type Resp[T R] struct {
 
 type AttrBase struct {
 	Name       string `json:"name"`
-	State      string `json:"state"`
+	State      State  `json:"state"`
 	CreateTime int64  `json:"create_time,omitempty"`
 	UpdateTime int64  `json:"update_time,omitempty"`
 }
@@ -0,0 +1,156 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Only query.* methods
+// are retried automatically; create.*, update.* and delete.* methods are
+// retried only when RetryMutations is set or the context was built with
+// WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, the first one included.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of each backoff that is randomized, in [0, 1].
+	Jitter float64
+
+	// RetryStatuses lists the HTTP status codes that are retried.
+	RetryStatuses []int
+	// RetryOn reports whether a transport error is retried. It defaults to
+	// timeouts, connection resets and refused connections.
+	RetryOn func(err error) bool
+
+	RetryMutations bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryStatuses:  []int{429, 502, 503, 504},
+	}
+}
+
+type retryKey struct{}
+
+// WithRetry opts the calls made with ctx into retries, including non-idempotent
+// create.*, update.* and delete.* methods.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func (p RetryPolicy) allowed(ctx context.Context, method string) bool {
+	if p.MaxAttempts <= 1 {
+		return false
+	}
+	if strings.HasPrefix(method, "query.") || p.RetryMutations {
+		return true
+	}
+	optIn, _ := ctx.Value(retryKey{}).(bool)
+	return optIn
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return slices.Contains(p.RetryStatuses, he.StatusCode)
+	}
+	if p.RetryOn != nil {
+		return p.RetryOn(err)
+	}
+	return isTransientErr(err)
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	for i := 1; i < attempt; i++ {
+		d *= mult
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			d = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func isTransientErr(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// withRetry runs fn until it succeeds, the policy gives up or ctx is done.
+// Each attempt waits for the rate limiter first, and the outcome is reported
+// to the circuit breaker.
+func (c *Client) withRetry(ctx context.Context, method string, fn func() error) error {
+	probe, err := c.breaker.allow()
+	if err != nil {
+		return err
+	}
+
+	err = c.retryLoop(ctx, method, fn)
+	c.breaker.record(ctx, probe, err)
+	return err
+}
+
+func (c *Client) retryLoop(ctx context.Context, method string, fn func() error) error {
+	send := func() error {
+		if err := c.limiter.wait(ctx, method); err != nil {
+			return err
+		}
+		return fn()
+	}
+	if !c.retry.allowed(ctx, method) {
+		return send()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt >= c.retry.MaxAttempts || ctx.Err() != nil || !c.retry.retryable(err) {
+			return err
+		}
+
+		d := c.retry.backoff(attempt)
+		c.log.Info("retry apollo request", "method", method, "attempt", attempt, "backoff", d, "error", err)
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
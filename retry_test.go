@@ -0,0 +1,106 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+func fastRetry(c *apollo.Config) {
+	c.Retry.MaxAttempts = 3
+	c.Retry.InitialBackoff = time.Millisecond
+	c.Retry.MaxBackoff = 5 * time.Millisecond
+}
+
+func TestRetryQuery(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+
+	srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusServiceUnavailable, Times: 2})
+	res, err := cli.QueryResById(context.Background(), host.ID)
+	if err != nil {
+		t.Fatalf("QueryResById: %v", err)
+	}
+	if res.ID != host.ID {
+		t.Errorf("ID = %d, want %d", res.ID, host.ID)
+	}
+	if n := calls(srv, "query.resource"); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+
+	srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusBadGateway})
+	_, err := cli.QueryResById(context.Background(), 1)
+	if !errors.Is(err, apollo.BadGateway) {
+		t.Fatalf("err = %v, want BadGateway", err)
+	}
+	if n := calls(srv, "query.resource"); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestRetryNonRetryableStatus(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+
+	srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusInternalServerError})
+	if _, err := cli.QueryResById(context.Background(), 1); err == nil {
+		t.Fatal("QueryResById succeeded")
+	}
+	if n := calls(srv, "query.resource"); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func TestRetryMutations(t *testing.T) {
+	cli, srv := newTestClient(t, fastRetry)
+	host := srv.AddResource(apollotest.Res("host", "db01", nil), "dba")
+	ctx := context.Background()
+
+	srv.Inject(apollotest.Fault{Method: "update.resource", Status: http.StatusServiceUnavailable, Times: 1})
+	if _, err := cli.UpdateResById(ctx, host.ID, apollo.Attr{"cpu": 4}); err == nil {
+		t.Fatal("UpdateResById succeeded without retries")
+	}
+	if n := calls(srv, "update.resource"); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+
+	srv.Inject(apollotest.Fault{Method: "update.resource", Status: http.StatusServiceUnavailable, Times: 1})
+	ok, err := cli.UpdateResById(apollo.WithRetry(ctx), host.ID, apollo.Attr{"cpu": 4})
+	if err != nil || !ok {
+		t.Fatalf("UpdateResById with WithRetry = %v, %v", ok, err)
+	}
+	if n := calls(srv, "update.resource"); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Retry.MaxAttempts = 5
+		c.Retry.InitialBackoff = time.Hour
+		c.Retry.MaxBackoff = time.Hour
+	})
+
+	srv.Inject(apollotest.Fault{Method: "query.resource", Status: http.StatusServiceUnavailable})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := cli.QueryResById(ctx, 1)
+	if !apollo.IsRetryable(err) {
+		t.Fatalf("err = %v, want the last attempt error", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("QueryResById returned after %v, want the context deadline", d)
+	}
+	if n := calls(srv, "query.resource"); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
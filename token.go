@@ -0,0 +1,215 @@
+package apollo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrEmptyToken = errors.New("apollo token is empty")
+
+// TokenSource provides the token sent in the "token" header. It is called for
+// every request, so implementations should be cheap or cache their value.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// tokenError wraps the errors of a TokenSource, which say nothing about the
+// availability of Apollo.
+type tokenError struct {
+	err error
+}
+
+func (e *tokenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.err
+}
+
+// TokenInvalidator is implemented by the token sources that cache their
+// token. After a 401 or 403 response the client invalidates the token and
+// retries the request once.
+type TokenInvalidator interface {
+	Invalidate()
+}
+
+// StaticToken always returns token. The token is redacted when the source is
+// printed.
+func StaticToken(token string) TokenSource {
+	return &staticToken{token: token}
+}
+
+type staticToken struct {
+	token string
+}
+
+func (s *staticToken) String() string {
+	return "StaticToken(" + redacted + ")"
+}
+
+func (s *staticToken) GoString() string {
+	return s.String()
+}
+
+func (s *staticToken) Token(context.Context) (string, error) {
+	if s.token == "" {
+		return "", ErrEmptyToken
+	}
+	return s.token, nil
+}
+
+// EnvToken reads the token from the environment variable name.
+func EnvToken(name string) TokenSource {
+	return &envToken{name: name}
+}
+
+type envToken struct {
+	name string
+}
+
+func (e *envToken) Token(context.Context) (string, error) {
+	token := strings.TrimSpace(os.Getenv(e.name))
+	if token == "" {
+		return "", fmt.Errorf("%w: $%s is not set", ErrEmptyToken, e.name)
+	}
+	return token, nil
+}
+
+// FileToken reads the token from the file at path. The file is stat'ed on
+// every call and read again when its modification time or size changes, so
+// that rotated tokens are picked up on the next request. A rotation that
+// changes neither, within the resolution of the file system clock, is only
+// seen after Apollo rejects the old token, as the 401 or 403 response makes
+// the client read the file again.
+func FileToken(path string) TokenSource {
+	return &fileToken{path: path}
+}
+
+type fileToken struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func (f *fileToken) String() string {
+	return "FileToken(" + f.path + ")"
+}
+
+func (f *fileToken) GoString() string {
+	return f.String()
+}
+
+func (f *fileToken) Token(context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+	if f.token != "" && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.token, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	token := string(bytes.TrimSpace(b))
+	if token == "" {
+		return "", fmt.Errorf("%w: %s is empty", ErrEmptyToken, f.path)
+	}
+
+	f.token, f.modTime, f.size = token, fi.ModTime(), fi.Size()
+	return token, nil
+}
+
+func (f *fileToken) Invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.token = ""
+}
+
+// CommandToken runs a command and uses its trimmed output as token. The
+// token is cached for ttl.
+func CommandToken(ttl time.Duration, name string, args ...string) TokenSource {
+	return CachedToken(&commandToken{name: name, args: args}, ttl)
+}
+
+type commandToken struct {
+	name string
+	args []string
+}
+
+func (c *commandToken) Token(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, c.name, c.args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("apollo token command %s: %w", c.name, err)
+	}
+
+	token := string(bytes.TrimSpace(out))
+	if token == "" {
+		return "", fmt.Errorf("%w: %s printed nothing", ErrEmptyToken, c.name)
+	}
+	return token, nil
+}
+
+// CachedToken caches the tokens of src for ttl.
+func CachedToken(src TokenSource, ttl time.Duration) TokenSource {
+	return &cachedToken{src: src, ttl: ttl}
+}
+
+type cachedToken struct {
+	src TokenSource
+	ttl time.Duration
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (c *cachedToken) String() string {
+	return fmt.Sprintf("CachedToken(%v, %v)", c.src, c.ttl)
+}
+
+func (c *cachedToken) GoString() string {
+	return c.String()
+}
+
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	token, err := c.src.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, time.Now().Add(c.ttl)
+	return token, nil
+}
+
+func (c *cachedToken) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = ""
+	if inv, ok := c.src.(TokenInvalidator); ok {
+		inv.Invalidate()
+	}
+}
@@ -0,0 +1,125 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+)
+
+func TestStaticTokenRedacted(t *testing.T) {
+	src := apollo.StaticToken(testToken)
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		if out := fmt.Sprintf(verb, src); strings.Contains(out, testToken) {
+			t.Errorf("Sprintf(%s) = %s, leaks the token", verb, out)
+		}
+	}
+	cached := apollo.CachedToken(src, time.Minute)
+	_, _ = cached.Token(context.Background())
+	if out := fmt.Sprintf("%+v", cached); strings.Contains(out, testToken) {
+		t.Errorf("CachedToken prints as %s, leaks the token", out)
+	}
+
+	if _, err := apollo.StaticToken("").Token(context.Background()); !errors.Is(err, apollo.ErrEmptyToken) {
+		t.Errorf("StaticToken(\"\") = %v, want ErrEmptyToken", err)
+	}
+}
+
+func TestEnvToken(t *testing.T) {
+	t.Setenv("APOLLO_TEST_TOKEN", " abc \n")
+	token, err := apollo.EnvToken("APOLLO_TEST_TOKEN").Token(context.Background())
+	if err != nil || token != "abc" {
+		t.Errorf("EnvToken = %q, %v, want abc", token, err)
+	}
+	if _, err = apollo.EnvToken("APOLLO_TEST_UNSET").Token(context.Background()); !errors.Is(err, apollo.ErrEmptyToken) {
+		t.Errorf("EnvToken(unset) = %v, want ErrEmptyToken", err)
+	}
+}
+
+func TestFileToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	write := func(token string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	src := apollo.FileToken(path)
+	write("first", now)
+	if token, err := src.Token(ctx); err != nil || token != "first" {
+		t.Fatalf("Token = %q, %v, want first", token, err)
+	}
+
+	write("second", now.Add(time.Second))
+	if token, _ := src.Token(ctx); token != "second" {
+		t.Errorf("Token = %q after rotation, want second", token)
+	}
+
+	// same size and modification time: only seen once invalidated.
+	write("third!", now.Add(time.Second))
+	if token, _ := src.Token(ctx); token != "second" {
+		t.Errorf("Token = %q, want the cached second", token)
+	}
+	src.(apollo.TokenInvalidator).Invalidate()
+	if token, _ := src.Token(ctx); token != "third!" {
+		t.Errorf("Token = %q after Invalidate, want third!", token)
+	}
+
+	if out := fmt.Sprintf("%v", src); strings.Contains(out, "third!") {
+		t.Errorf("FileToken prints as %s, leaks the token", out)
+	}
+}
+
+// rotatingToken returns a stale token until it is invalidated.
+type rotatingToken struct {
+	invalidated atomic.Bool
+}
+
+func (r *rotatingToken) Token(context.Context) (string, error) {
+	if r.invalidated.Load() {
+		return testToken, nil
+	}
+	return "stale", nil
+}
+
+func (r *rotatingToken) Invalidate() {
+	r.invalidated.Store(true)
+}
+
+func TestTokenRefreshOnUnauthorized(t *testing.T) {
+	src := &rotatingToken{}
+	cli, srv := newTestClient(t, func(c *apollo.Config) {
+		c.Token = ""
+		c.TokenSource = src
+	})
+	srv.AddType("host")
+
+	types, err := cli.ListTypes(context.Background())
+	if err != nil || len(types) != 1 {
+		t.Fatalf("ListTypes = %v, %v", types, err)
+	}
+	if !src.invalidated.Load() {
+		t.Error("the rejected token wasn't invalidated")
+	}
+}
+
+func TestCommandToken(t *testing.T) {
+	src := apollo.CommandToken(time.Minute, "echo", "from-command")
+	token, err := src.Token(context.Background())
+	if err != nil || token != "from-command" {
+		t.Errorf("CommandToken = %q, %v", token, err)
+	}
+}
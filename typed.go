@@ -0,0 +1,199 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// AttrError reports an attribute that can't be decoded into its struct field.
+type AttrError struct {
+	Attr  string
+	Field string
+	Type  reflect.Type
+	Value any
+	Err   error
+}
+
+func (e *AttrError) Error() string {
+	return fmt.Sprintf("apollo: attribute %q (%s %s) doesn't fit field %s of type %s",
+		e.Attr, jsonKind(e.Value), formatCondValue(e.Value), e.Field, e.Type)
+}
+
+func (e *AttrError) Unwrap() error {
+	return e.Err
+}
+
+// TypedResource is a Resource whose attributes are decoded into a T.
+type TypedResource[T any] struct {
+	ResBase
+
+	Attrs T   `json:"attributes"`
+	Rel   Rel `json:"relations,omitempty"`
+}
+
+// NewTyped decodes the attributes of r into a TypedResource.
+func NewTyped[T any](r *Resource) (*TypedResource[T], error) {
+	attrs, err := DecodeAttrs[T](r)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedResource[T]{ResBase: r.ResBase, Attrs: attrs, Rel: r.Rel}, nil
+}
+
+// Resource converts t back to an untyped Resource, e.g. for UpdateRes.
+func (t *TypedResource[T]) Resource() (Resource, error) {
+	attrs, err := EncodeAttrs(t.Attrs)
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{ResBase: t.ResBase, Attrs: attrs, Rel: t.Rel}, nil
+}
+
+// DecodeAttrs decodes the attributes of r into T, which must be a struct.
+// Fields are matched to attribute names by their `apollo` tag, then their
+// `json` tag, then their name; embedded structs such as AttrBase are
+// flattened. Missing attributes leave the field at its zero value.
+func DecodeAttrs[T any](r *Resource) (T, error) {
+	var v T
+	if r == nil {
+		return v, fmt.Errorf("apollo: can't decode attributes of a nil resource")
+	}
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() != reflect.Struct {
+		return v, fmt.Errorf("apollo: can't decode attributes into %s, want a struct", rv.Type())
+	}
+
+	for _, f := range attrFields(rv.Type()) {
+		value, ok := r.Attrs[f.attr]
+		if !ok || value == nil {
+			continue
+		}
+
+		raw, err := json.Marshal(value)
+		if err == nil {
+			err = json.Unmarshal(raw, rv.FieldByIndex(f.index).Addr().Interface())
+		}
+		if err != nil {
+			return v, &AttrError{Attr: f.attr, Field: f.name, Type: f.typ, Value: value, Err: err}
+		}
+	}
+	return v, nil
+}
+
+// EncodeAttrs is the reverse of DecodeAttrs. Fields tagged omitempty are
+// skipped when they hold their zero value.
+func EncodeAttrs[T any](v T) (Attr, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("apollo: can't encode attributes from %T, want a struct", v)
+	}
+
+	attrs := make(Attr)
+	for _, f := range attrFields(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		attrs[f.attr] = fv.Interface()
+	}
+	return attrs, nil
+}
+
+type attrField struct {
+	attr      string
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+func attrFields(t reflect.Type) []attrField {
+	var fields []attrField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag, ok := sf.Tag.Lookup("apollo")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range attrFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, attrField{
+			attr:      name,
+			name:      t.Name() + "." + sf.Name,
+			index:     []int{i},
+			typ:       sf.Type,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64, json.Number, int, int64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// QueryTyped runs q like Client.Find and decodes every resource into T.
+func QueryTyped[T any](ctx context.Context, c *Client, q *Query) ([]*TypedResource[T], error) {
+	res, err := c.Find(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]*TypedResource[T], 0, len(res))
+	for _, r := range res {
+		t, err := NewTyped[T](r)
+		if err != nil {
+			c.log.Error(err, "fail to decode resource attributes", "id", r.ID, "type", r.Type.Name)
+			return nil, err
+		}
+		typed = append(typed, t)
+	}
+	return typed, nil
+}
+
+// CreateTyped creates a resource of type rType with attrs in group.
+func CreateTyped[T any](ctx context.Context, c *Client, rType string, attrs T, group string) (*TypedResource[T], error) {
+	a, err := EncodeAttrs(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.CreateRes(ctx, Resource{ResBase: ResBase{Type: RType{Name: rType}}, Attrs: a}, group)
+	if err != nil {
+		return nil, err
+	}
+	return NewTyped[T](res)
+}
@@ -0,0 +1,99 @@
+package apollo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apollo "github.com/SisyphusSQ/apollo-sdk"
+	"github.com/SisyphusSQ/apollo-sdk/apollotest"
+)
+
+type hostAttrs struct {
+	apollo.AttrBase
+
+	CPU   int      `apollo:"cpu"`
+	IDC   string   `json:"idc,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"-"`
+}
+
+func TestDecodeAttrs(t *testing.T) {
+	r := &apollo.Resource{Attrs: apollo.Attr{
+		"name":  "db01",
+		"state": ":online",
+		"cpu":   float64(8),
+		"idc":   "sh",
+		"tags":  []any{"a", "b"},
+		"Notes": "ignored",
+	}}
+
+	h, err := apollo.DecodeAttrs[hostAttrs](r)
+	if err != nil {
+		t.Fatalf("DecodeAttrs: %v", err)
+	}
+	if h.Name != "db01" || h.State != apollo.Online || h.CPU != 8 || h.IDC != "sh" || len(h.Tags) != 2 || h.Notes != "" {
+		t.Errorf("DecodeAttrs = %+v", h)
+	}
+
+	attrs, err := apollo.EncodeAttrs(hostAttrs{AttrBase: apollo.AttrBase{Name: "db02"}, CPU: 2})
+	if err != nil {
+		t.Fatalf("EncodeAttrs: %v", err)
+	}
+	if attrs["name"] != "db02" || attrs["cpu"] != 2 {
+		t.Errorf("EncodeAttrs = %v", attrs)
+	}
+	if _, ok := attrs["idc"]; ok {
+		t.Errorf("EncodeAttrs kept the empty omitempty field idc: %v", attrs)
+	}
+}
+
+func TestDecodeAttrsErrors(t *testing.T) {
+	var attrErr *apollo.AttrError
+	_, err := apollo.DecodeAttrs[hostAttrs](&apollo.Resource{Attrs: apollo.Attr{"cpu": "eight"}})
+	if !errors.As(err, &attrErr) || attrErr.Attr != "cpu" {
+		t.Errorf("DecodeAttrs(cpu string) = %v, want *AttrError on cpu", err)
+	}
+
+	if _, err = apollo.DecodeAttrs[hostAttrs](nil); err == nil {
+		t.Error("DecodeAttrs(nil) succeeded")
+	}
+	if _, err = apollo.DecodeAttrs[any](&apollo.Resource{}); err == nil {
+		t.Error("DecodeAttrs[any] succeeded")
+	}
+	if _, err = apollo.EncodeAttrs[any](nil); err == nil {
+		t.Error("EncodeAttrs(nil) succeeded")
+	}
+
+	h, err := apollo.DecodeAttrs[hostAttrs](&apollo.Resource{})
+	if err != nil || h.Name != "" {
+		t.Errorf("DecodeAttrs(nil attrs) = %+v, %v, want the zero value", h, err)
+	}
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	cli, srv := newTestClient(t, nil)
+	ctx := context.Background()
+	srv.AddGroup(apollo.OpsGroup{Name: "dba"})
+
+	created, err := apollo.CreateTyped(ctx, cli, "host", hostAttrs{AttrBase: apollo.AttrBase{Name: "db01", State: apollo.Online}, CPU: 8}, "dba")
+	if err != nil {
+		t.Fatalf("CreateTyped: %v", err)
+	}
+	if created.ID == 0 || created.Attrs.CPU != 8 {
+		t.Errorf("CreateTyped = %+v", created)
+	}
+
+	hosts, err := apollo.QueryTyped[hostAttrs](ctx, cli, apollo.NewQuery().Type("host"))
+	if err != nil {
+		t.Fatalf("QueryTyped: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Attrs.Name != "db01" || hosts[0].Attrs.State != apollo.Online {
+		t.Errorf("QueryTyped = %+v", hosts)
+	}
+
+	srv.AddResource(apollotest.Res("host", "bad", apollo.Attr{"cpu": "many"}), "dba")
+	if _, err = apollo.QueryTyped[hostAttrs](ctx, cli, apollo.NewQuery().Type("host")); err == nil {
+		t.Error("QueryTyped succeeded with an invalid attribute")
+	}
+}